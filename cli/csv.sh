@@ -0,0 +1,13 @@
+#!/bin/sh
+
+dnsmasq_web_use dnsmasq_web_curl || {
+    echo no dnsmasq_web_csv without dnsmasq_web_curl &&
+        return
+}
+dnsmasq_web_csv() {
+    dnsmasq_web_curl "$1" "--header 'Accept: text/csv'"
+}
+
+for noun in clients leases reservations; do
+    eval "dnsmasq_web_csv_$noun() { dnsmasq_web_csv \"$noun?\$1\"; }"
+done
@@ -20,7 +20,7 @@ dnsmasq_web_try_curl() {
             dnsmasq_web_token
         fi
     )'"
-    eval curl "$args" "$url" "$*"
+    eval curl "$args" "'$url'" "$*"
 }
 
 dnsmasq_web_curl() {
@@ -10,15 +10,14 @@ dnsmasq_web_reservation_add() {
     } | dnsmasq_web_curl reservations -X POST -d @-
 }
 
-dnsmasq_web_reservation_delete() {
-    dnsmasq_web_curl "reservations/$1" -X DELETE
-}
-
-dnsmasq_web_use jq || return
 dnsmasq_web_reservation_change() {
     mac="$1"
     shift
-    dnsmasq_web_curl "reservations/$mac" |
-        jq ".$1 = $2" |
-        dnsmasq_web_curl "reservations/$mac" -X PUT -d @-
+    echo '{"'"$1"'":'"$2"'}' |
+        dnsmasq_web_curl "reservations/$mac" -X PATCH \
+            -H "'Content-Type: application/merge-patch+json'" -d @-
+}
+
+dnsmasq_web_reservation_delete() {
+    dnsmasq_web_curl "reservations/$1" -X DELETE
 }
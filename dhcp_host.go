@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// hwaddrPattern matches a hardware address with an optional hardware type prefix, e.g., 06-, and wildcard (*) bytes.
+	hwaddrPattern = regexp.MustCompile(`^([0-9a-fA-F]{1,2}-)?([0-9a-fA-F]{1,2}|\*)(:([0-9a-fA-F]{1,2}|\*)){1,19}$`)
+	// leaseTimePattern matches a lease time in seconds or with a unit of minutes, hours, days or weeks.
+	leaseTimePattern = regexp.MustCompile(`^([0-9]+[smhdwSMHDW]?|infinite)$`)
+)
+
+// isLeaseTime reports whether the argument is a lease time in the dnsmasq duration format.
+func isLeaseTime(arg string) bool {
+	return leaseTimePattern.MatchString(arg)
+}
+
+// normalizeHwaddr returns the hardware address in lower case, colon-delimited unless it has a hardware type prefix.
+func normalizeHwaddr(hwaddr string) string {
+	if !strings.Contains(hwaddr, "-") {
+		if mac, err := validateMAC(hwaddr); err == nil {
+			return mac.ToColonDelimitedString()
+		}
+	}
+	return strings.ToLower(hwaddr)
+}
+
+// parseDhcpHost parses the dhcp-host entry in content, i.e., the value of a dnsmasq dhcp-host option:
+//
+//	[<hwaddr>...][,id:<client_id>|*][,set:<tag>...][,tag:<tag>...][,<ipv4>][,[<ipv6>]...][,<hostname>][,<lease_time>][,ignore]
+//
+// Blank lines and comments are skipped but there must be exactly one entry.
+func parseDhcpHost(content string) (reservation, error) {
+	var line string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		if text := strings.TrimSpace(scanner.Text()); text != "" && !strings.HasPrefix(text, "#") {
+			if line != "" {
+				return reservation{}, fmt.Errorf("more than one dhcp-host entry")
+			}
+			line = text
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return reservation{}, err
+	}
+	if line == "" {
+		return reservation{}, fmt.Errorf("no dhcp-host entry")
+	}
+
+	res := reservation{reservationData: reservationData{Tags: []string{}}}
+	for _, arg := range strings.Split(line, ",") {
+		arg = strings.TrimSpace(arg)
+		lower := strings.ToLower(arg)
+		switch {
+		case arg == "":
+			return reservation{}, fmt.Errorf("empty field")
+		case strings.HasPrefix(lower, "id:"):
+			if res.ClientID != "" {
+				return reservation{}, fmt.Errorf("more than one client identifier")
+			}
+			res.ClientID = arg[3:]
+		case strings.HasPrefix(lower, "set:"), strings.HasPrefix(lower, "net:"):
+			res.Tags = append(res.Tags, arg[4:])
+		case strings.HasPrefix(lower, "tag:"):
+			res.MatchTags = append(res.MatchTags, arg[4:])
+		case strings.HasPrefix(arg, "[") && strings.HasSuffix(arg, "]"):
+			res.IPv6 = append(res.IPv6, arg[1:len(arg)-1])
+		case lower == "ignore":
+			res.Ignore = true
+		case isLeaseTime(lower):
+			if res.LeaseTime != "" {
+				return reservation{}, fmt.Errorf("more than one lease time")
+			}
+			res.LeaseTime = arg
+		case hwaddrPattern.MatchString(arg):
+			if res.MAC == "" {
+				res.MAC = normalizeHwaddr(arg)
+			} else {
+				res.MACs = append(res.MACs, normalizeHwaddr(arg))
+			}
+		default:
+			if addr, err := validateIPv4(arg); err == nil && addr.IsIPv4() {
+				if res.IPv4 != "" {
+					return reservation{}, fmt.Errorf("more than one IPv4 address")
+				}
+				res.IPv4 = arg
+			} else if res.Hostname != "" {
+				return reservation{}, fmt.Errorf("unrecognized field '%s'", arg)
+			} else {
+				res.Hostname = arg
+			}
+		}
+	}
+	return res, nil
+}
+
+// formatDhcpHost returns the reservation as a dhcp-host line in the order of the dnsmasq documentation.
+func formatDhcpHost(res reservation) string {
+	var fields []string
+	if res.MAC != "" {
+		fields = append(fields, res.MAC)
+	}
+	fields = append(fields, res.MACs...)
+	if res.ClientID != "" {
+		fields = append(fields, "id:"+res.ClientID)
+	}
+	fields = append(fields, prefixTags(res.Tags)...)
+	for _, tag := range res.MatchTags {
+		fields = append(fields, "tag:"+tag)
+	}
+	if res.IPv4 != "" {
+		fields = append(fields, res.IPv4)
+	}
+	for _, ipv6 := range res.IPv6 {
+		fields = append(fields, "["+ipv6+"]")
+	}
+	if res.Hostname != "" {
+		fields = append(fields, res.Hostname)
+	}
+	if res.LeaseTime != "" {
+		fields = append(fields, res.LeaseTime)
+	}
+	if res.Ignore {
+		fields = append(fields, "ignore")
+	}
+	return strings.Join(fields, ",") + "\n"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDhcpHost(t *testing.T) {
+	res, err := parseDhcpHost("00:1a:2b:3c:4d:5e,set:tag1,set:tag2,192.168.1.100,host1,24h\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", res.MAC)
+	assert.Equal(t, []string{"tag1", "tag2"}, res.Tags)
+	assert.Equal(t, "192.168.1.100", res.IPv4)
+	assert.Equal(t, "host1", res.Hostname)
+	assert.Equal(t, "24h", res.LeaseTime)
+}
+
+func TestParseDhcpHostFullGrammar(t *testing.T) {
+	res, err := parseDhcpHost(
+		"# a laptop with two interfaces\n" +
+			"00:1A:2B:3C:4D:5E,00:1a:2b:3c:4d:*,id:*,set:trusted,tag:!guest,192.168.1.100,[fd00::100],laptop,infinite\n",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", res.MAC)
+	assert.Equal(t, []string{"00:1a:2b:3c:4d:*"}, res.MACs)
+	assert.Equal(t, "*", res.ClientID)
+	assert.Equal(t, []string{"trusted"}, res.Tags)
+	assert.Equal(t, []string{"!guest"}, res.MatchTags)
+	assert.Equal(t, "192.168.1.100", res.IPv4)
+	assert.Equal(t, []string{"fd00::100"}, res.IPv6)
+	assert.Equal(t, "laptop", res.Hostname)
+	assert.Equal(t, "infinite", res.LeaseTime)
+
+	res, err = parseDhcpHost("06-00:1a:2b:3c:4d:5e,ignore")
+	assert.NoError(t, err)
+	assert.Equal(t, "06-00:1a:2b:3c:4d:5e", res.MAC)
+	assert.True(t, res.Ignore)
+	assert.Empty(t, res.IPv4)
+}
+
+func TestParseDhcpHostErrors(t *testing.T) {
+	for _, content := range []string{
+		"",
+		"# only a comment",
+		"00:1a:2b:3c:4d:5e,192.168.1.100\n00:1a:2b:3c:4d:5f,192.168.1.101\n",
+		"00:1a:2b:3c:4d:5e,192.168.1.100,192.168.1.101",
+		"00:1a:2b:3c:4d:5e,192.168.1.100,host1,host2",
+		"00:1a:2b:3c:4d:5e,,192.168.1.100",
+	} {
+		_, err := parseDhcpHost(content)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestFormatDhcpHostRoundTrip(t *testing.T) {
+	for _, line := range []string{
+		"00:1a:2b:3c:4d:5e,192.168.1.100\n",
+		"00:1a:2b:3c:4d:5e,set:tag1,set:tag2,192.168.1.100,host1,24h\n",
+		"00:1a:2b:3c:4d:5e,00:1a:2b:3c:4d:5f,id:01:00:1a:2b:3c:4d:5e,set:a,tag:b,192.168.1.100,[fd00::100],host1,infinite\n",
+		"00:1a:2b:*:*:*,set:unsafe\n",
+		"00:1a:2b:3c:4d:5e,ignore\n",
+	} {
+		res, err := parseDhcpHost(line)
+		assert.NoError(t, err, line)
+		assert.Equal(t, line, formatDhcpHost(res))
+	}
+}
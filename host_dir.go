@@ -2,21 +2,35 @@ package main
 
 import (
 	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
-	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/seancfoley/ipaddress-go/ipaddr"
 )
 
+// reservationData holds the fields of a dhcp-host entry other than its (first) MAC address.
+// The IPv4 address is required unless there are IPv6 addresses or the entry is ignore.
 type reservationData struct {
 	Tags      []string `json:"tags"`
-	IPv4      string   `json:"ipv4" binding:"required"`
+	IPv4      string   `json:"ipv4"`
 	Hostname  string   `json:"hostname,omitempty"`
 	LeaseTime string   `json:"lease_time,omitempty"`
+	MACs      []string `json:"macs,omitempty"`       // more hardware addresses, which may have wildcards
+	ClientID  string   `json:"client_id,omitempty"`  // the client identifier or * to ignore it
+	MatchTags []string `json:"match_tags,omitempty"` // the tag: conditions
+	IPv6      []string `json:"ipv6,omitempty"`
+	Ignore    bool     `json:"ignore,omitempty"`
+	reservationMetadata
 }
 
 type reservation struct {
@@ -24,6 +38,52 @@ type reservation struct {
 	reservationData
 }
 
+// reservationInput is the body of POST /reservations, a reservation whose IPv4 address may be allocated from a pool.
+type reservationInput struct {
+	MAC string `json:"mac" binding:"required"`
+	reservationData
+	Pool string `json:"pool,omitempty"` // the CIDR or range to allocate the IPv4 address from when it is auto
+}
+
+func (input reservationInput) reservation() reservation {
+	return reservation{MAC: input.MAC, reservationData: input.reservationData}
+}
+
+// checkPool returns an error unless there is a pool exactly when the IPv4 address is auto.
+func (input reservationInput) checkPool() error {
+	if (input.IPv4 == autoIPv4) != (input.Pool != "") {
+		return fmt.Errorf("a pool is required with ipv4 auto and only with it")
+	}
+	return nil
+}
+
+// importRow is a reservation decoded from an import with its (1-based) row number and any decoding error.
+type importRow struct {
+	reservation
+	row int
+	err error
+}
+
+// importResult reports what happened to one row of an import.
+type importResult struct {
+	Row      int             `json:"row"`
+	MAC      string          `json:"mac,omitempty"`
+	Status   int             `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Conflict *conflictError  `json:"conflict,omitempty"`
+	Fields   validationError `json:"fields,omitempty"`
+}
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+	mimeCSV    = "text/csv"
+)
+
+var reservationCSVHeader = []string{
+	"mac", "ipv4", "hostname", "lease_time", "tags", "macs", "client_id", "match_tags", "ipv6", "ignore",
+	"description", "owner", "asset_id", "expires_at", "on_expiry",
+}
+
 func validateMAC(mac string) (*ipaddr.MACAddress, error) {
 	addr, err := ipaddr.NewMACAddressString(mac).ToAddress()
 	if err != nil {
@@ -40,57 +100,218 @@ func validateIPv4(ipv4 string) (*ipaddr.IPAddress, error) {
 	return addr, nil
 }
 
-func createReservationFile(input reservation, c *gin.Context, hostDir string, overwrite bool) {
-	mac, err := validateMAC(input.MAC)
+// formatReservation validates the input and returns its file name, i.e., the normalized MAC, and content.
+func formatReservation(input reservation) (string, string, error) {
+	res, err := validateReservation(input)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid MAC address"})
-		return
+		return "", "", err
+	}
+	mac, _ := validateMAC(res.MAC)
+	return mac.ToNormalizedString(), formatDhcpHost(res), nil
+}
+
+// errorResponse returns the JSON body for the error with the details of a conflict or the rejected fields.
+func errorResponse(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var conflict *conflictError
+	var invalid validationError
+	if errors.As(err, &conflict) {
+		body["conflict"] = conflict
+	} else if errors.As(err, &invalid) {
+		body["fields"] = invalid
 	}
+	return body
+}
 
-	content := mac.ToColonDelimitedString()
+// writeOptions control how writeReservationFile treats an existing reservation.
+type writeOptions struct {
+	overwrite bool         // replace an existing reservation
+	force     bool         // skip checking for conflicts with other reservations
+	condition precondition // the If-Match and If-None-Match headers
+	operation string       // the operation recorded in the history; create or update when empty
+	identity  string       // who is making the change
+}
 
-	if len(input.Tags) > 0 {
-		content += "," + strings.Join(prefixTags(input.Tags), ",")
+// newWriteOptions returns the options for a request from its force query parameter, precondition headers and identity.
+func newWriteOptions(c *gin.Context, overwrite bool) writeOptions {
+	return writeOptions{
+		overwrite: overwrite,
+		force:     c.Query("force") == "true",
+		condition: requestPrecondition(c),
+		identity:  requestIdentity(c),
 	}
-	if ipv4, err := validateIPv4(input.IPv4); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid IPv4 address"})
-		return
-	} else {
-		content += "," + ipv4.String()
+}
+
+// writeReservationFile writes the reservation into hostDir and returns the HTTP status that describes the result.
+// It returns a *conflictError when another MAC reserves the same IPv4 address or hostname unless force is set.
+func writeReservationFile(input reservation, hostDir *hostDirectory, opts writeOptions) (int, error) {
+	// Hold the directory lock exclusively so no other change can reserve the same address or hostname
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	return storeReservationFile(input, hostDir, opts)
+}
+
+// storeReservationFile does the work of writeReservationFile; the caller must hold the directory lock exclusively.
+func storeReservationFile(input reservation, hostDir *hostDirectory, opts writeOptions) (int, error) {
+	if mac, err := validateMAC(input.MAC); err == nil {
+		defer hostDir.lockFile(mac.ToNormalizedString())()
 	}
-	if input.Hostname != "" {
-		content += "," + input.Hostname
+	change, status, err := prepareReservationFile(input, hostDir, nil, opts)
+	if err != nil {
+		return status, err
 	}
-	if input.LeaseTime != "" {
-		content += "," + input.LeaseTime
+	if err := hostDir.commit(change); err != nil {
+		return http.StatusInternalServerError, err
 	}
-	content += "\n"
 
-	filePath := filepath.Join(hostDir, mac.ToNormalizedString())
-	if _, err := os.Stat(filePath); err == nil && !overwrite {
-		c.JSON(http.StatusConflict, gin.H{"error": "exists"})
-		return
+	return http.StatusCreated, nil
+}
+
+// prepareReservationFile runs every check of storeReservationFile and returns the change it would commit.
+// It checks for conflicts with idx or, when it is nil, with the reservations in hostDir.
+// The caller must hold the directory lock.
+func prepareReservationFile(input reservation, hostDir *hostDirectory, idx *reservationIndex, opts writeOptions) (reservationChange, int, error) {
+	name, content, err := formatReservation(input)
+	if err != nil {
+		return reservationChange{}, http.StatusBadRequest, err
 	}
-	if err := os.WriteFile(filePath, []byte(content), 0640); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+
+	etag, exists := "", false
+	current, err := os.ReadFile(hostDir.filePath(name))
+	if err == nil {
+		etag, exists = hostDir.entityTag(name, current), true
+	} else if !os.IsNotExist(err) {
+		return reservationChange{}, http.StatusInternalServerError, err
+	}
+	if !opts.condition.satisfied(etag) {
+		return reservationChange{}, http.StatusPreconditionFailed, errPreconditionFailed
+	}
+	if exists && !opts.overwrite {
+		return reservationChange{}, http.StatusConflict, fmt.Errorf("exists")
+	}
+	if !opts.force {
+		if idx == nil {
+			reservations, err := readReservations(hostDir)
+			if err != nil {
+				return reservationChange{}, http.StatusInternalServerError, err
+			}
+			idx = newReservationIndex(reservations)
+		}
+		if err := idx.conflict(name, input); err != nil {
+			return reservationChange{}, http.StatusConflict, err
+		}
+	}
+	operation := opts.operation
+	if operation == "" && exists {
+		operation = "update"
+	} else if operation == "" {
+		operation = "create"
+	}
+	change := reservationChange{
+		Name: name, Operation: operation, Identity: opts.identity, Previous: current, Content: []byte(content),
+		Metadata: &input.reservationMetadata,
 	}
+	return change, http.StatusCreated, nil
+}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "success"})
+func createReservationFile(input reservation, c *gin.Context, hostDir *hostDirectory, overwrite bool) {
+	if status, err := writeReservationFile(input, hostDir, newWriteOptions(c, overwrite)); err != nil {
+		c.JSON(status, errorResponse(err))
+	} else {
+		c.JSON(status, gin.H{"message": "success"})
+	}
 }
 
-func updateReservationFile(input reservationData, mac string, c *gin.Context, hostDir string) {
+func updateReservationFile(input reservationData, mac string, c *gin.Context, hostDir *hostDirectory) {
 	createReservationFile(reservation{MAC: mac, reservationData: input}, c, hostDir, true)
 }
 
-func deleteReservationFile(c *gin.Context, hostDir string) {
+// patchReservationFile applies a JSON Merge Patch (RFC 7396) or, by its content type, a JSON Patch (RFC 6902)
+// to the reservation while holding the directory lock, so the change is atomic.
+func patchReservationFile(c *gin.Context, hostDir *hostDirectory) {
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changeReservationFile(c, hostDir, "patch", func(current reservation) (reservation, int, error) {
+		patched, err := patchReservation(current, c.ContentType(), patch)
+		return patched, http.StatusBadRequest, err
+	})
+}
+
+// changeReservationFile changes the reservation of the mac parameter while holding the directory lock,
+// after checking the precondition headers. The change returns the status to respond with when it fails.
+// Nothing is written when the change leaves the reservation as it was.
+func changeReservationFile(c *gin.Context, hostDir *hostDirectory, operation string, change func(current reservation) (reservation, int, error)) {
 	mac, err := validateMAC(c.Param("mac"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid MAC address"})
 		return
 	}
-	filePath := filepath.Join(hostDir, mac.ToNormalizedString())
-	if err := os.Remove(filePath); err != nil {
+	name := mac.ToNormalizedString()
+
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	opts := newWriteOptions(c, true)
+	opts.operation = operation
+	current, etag, err := readReservationFileTag(name, hostDir)
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !opts.condition.satisfied(etag) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such reservation"})
+		return
+	}
+	changed, status, err := change(current)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if other, err := validateMAC(changed.MAC); err != nil || other.ToNormalizedString() != name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the MAC address of a reservation cannot be changed"})
+		return
+	}
+
+	if reflect.DeepEqual(changed, current) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	} else if status, err := storeReservationFile(changed, hostDir, opts); err != nil {
+		c.JSON(status, errorResponse(err))
+	} else {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	}
+}
+
+func deleteReservationFile(c *gin.Context, hostDir *hostDirectory) {
+	mac, err := validateMAC(c.Param("mac"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid MAC address"})
+		return
+	}
+	name := mac.ToNormalizedString()
+
+	hostDir.mu.RLock()
+	defer hostDir.mu.RUnlock()
+	defer hostDir.lockFile(name)()
+
+	etag := ""
+	current, err := os.ReadFile(hostDir.filePath(name))
+	if err == nil {
+		etag = hostDir.entityTag(name, current)
+	}
+	if !requestPrecondition(c).satisfied(etag) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+		return
+	}
+	if err != nil {
 		if os.IsNotExist(err) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "no such reservation"})
 		} else {
@@ -98,71 +319,54 @@ func deleteReservationFile(c *gin.Context, hostDir string) {
 		}
 		return
 	}
+	change := reservationChange{Name: name, Operation: "delete", Identity: requestIdentity(c), Previous: current}
+	if err := hostDir.commit(change); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "success"})
 }
 
-func readReservationFile(mac string, hostDir string) (reservation, error) {
-	filePath := filepath.Join(hostDir, mac)
-	file, err := os.Open(filePath)
+// readReservationFile reads the reservation in the file without its metadata.
+func readReservationFile(mac string, hostDir *hostDirectory) (reservation, error) {
+	content, err := os.ReadFile(hostDir.filePath(mac))
 	if err != nil {
 		return reservation{}, err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	if scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, ",")
-		if len(parts) < 3 {
-			return reservation{}, fmt.Errorf("invalid file format")
-		}
-
-		res := reservation{
-			MAC: parts[0],
-			reservationData: reservationData{
-				Tags:      []string{},
-				IPv4:      parts[1],
-				Hostname:  "",
-				LeaseTime: "",
-			},
-		}
-		if strings.HasPrefix(parts[1], "set:") {
-			res.Tags = strings.Split(strings.Replace(parts[1], "set:", "", 1), ",")
-			res.IPv4 = parts[2]
-			if len(parts) > 3 {
-				res.Hostname = parts[3]
-			}
-			if len(parts) > 4 {
-				res.LeaseTime = parts[4]
-			}
-		} else {
-			if len(parts) > 2 {
-				res.Hostname = parts[2]
-			}
-			if len(parts) > 3 {
-				res.LeaseTime = parts[3]
-			}
-		}
+	return parseDhcpHost(string(content))
+}
 
-		return res, nil
+// readReservationFileTag reads the reservation with its metadata and returns it with its entity tag.
+func readReservationFileTag(mac string, hostDir *hostDirectory) (reservation, string, error) {
+	content, err := os.ReadFile(hostDir.filePath(mac))
+	if err != nil {
+		return reservation{}, "", err
 	}
-
-	if err := scanner.Err(); err != nil {
-		return reservation{}, err
+	res, err := parseDhcpHost(string(content))
+	if err != nil {
+		return res, "", err
+	}
+	if res.reservationMetadata, err = hostDir.metadata.get(mac); err != nil {
+		return res, "", err
 	}
-	return reservation{}, nil
+	return res, hostDir.entityTag(mac, content), nil
 }
 
-func getReservationFile(c *gin.Context, hostDir string) {
+func getReservationFile(c *gin.Context, hostDir *hostDirectory) {
 	macParam := c.Param("mac")
 	if macParam != "" {
 		mac, err := validateMAC(macParam)
 		if err != nil || !mac.ToAddressString().IsValid() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid MAC address"})
 		} else {
-			if res, err := readReservationFile(mac.ToNormalizedString(), hostDir); err == nil {
-				c.JSON(http.StatusOK, res)
+			if res, etag, err := readReservationFileTag(mac.ToNormalizedString(), hostDir); err == nil {
+				c.Header("ETag", etag)
+				if matchesEntityTag(c.GetHeader("If-None-Match"), etag, true) {
+					c.Status(http.StatusNotModified)
+				} else {
+					c.JSON(http.StatusOK, res)
+				}
 			} else {
 				if os.IsNotExist(err) {
 					c.JSON(http.StatusNotFound, gin.H{"error": "no such reservation"})
@@ -172,55 +376,373 @@ func getReservationFile(c *gin.Context, hostDir string) {
 			}
 		}
 	} else {
-		var reservations []reservation
-		err := filepath.Walk(hostDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
+		if q, err := newReservationQuery(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if reservations, err := queryReservations(hostDir, q); err == nil {
+			writeList(c, reservations, reservationCSVHeader, reservationToCSV)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// listReservations returns every reservation in hostDir with its metadata while holding the directory lock shared.
+func listReservations(hostDir *hostDirectory) ([]reservation, error) {
+	hostDir.mu.RLock()
+	defer hostDir.mu.RUnlock()
+
+	reservations, err := readReservations(hostDir)
+	if err != nil {
+		return nil, err
+	}
+	return reservations, hostDir.metadata.attach(reservations)
+}
+
+// readReservations returns every reservation in hostDir ordered by MAC; the caller must hold the directory lock.
+// It skips subdirectories and the files that are not reservations, which lintHostDirectory reports.
+func readReservations(hostDir *hostDirectory) ([]reservation, error) {
+	var reservations []reservation
+	err := hostDir.withIndex(func(idx *reservationIndex) {
+		reservations = idx.sortedReservations()
+	})
+	return reservations, err
+}
+
+// scanReservations reads every reservation file in hostDir into an index keyed by file name.
+func scanReservations(hostDir *hostDirectory) (*reservationIndex, error) {
+	entries, err := os.ReadDir(hostDir.path)
+	if err != nil {
+		return nil, err
+	}
+	idx := newReservationIndex(nil)
+	for _, entry := range entries {
+		if entry.IsDir() || ignoredByDnsmasq(entry.Name()) {
+			continue
+		}
+		if mac, err := validateMAC(entry.Name()); err == nil && mac.ToNormalizedString() == entry.Name() {
+			if res, err := readReservationFile(entry.Name(), hostDir); err == nil {
+				idx.set(entry.Name(), res)
 			}
-			if !info.IsDir() {
-				macAddr, err := validateMAC(info.Name())
-				if err == nil {
-					file, err := os.Open(path)
-					if err != nil {
-						return err
-					}
-					defer file.Close()
-
-					if res, err := readReservationFile(macAddr.ToNormalizedString(), hostDir); err == nil {
-						reservations = append(reservations, res)
-					}
+		}
+	}
+	return idx, nil
+}
+
+// reservationFormat returns the MIME type named by the format query parameter or the fallback when there is none.
+func reservationFormat(c *gin.Context, fallback string) string {
+	switch c.Query("format") {
+	case "json":
+		return gin.MIMEJSON
+	case "ndjson":
+		return mimeNDJSON
+	case "csv":
+		return mimeCSV
+	}
+	return fallback
+}
+
+// reservationFromCSV maps a CSV record onto a reservation using the column names in the header.
+func reservationFromCSV(header, record []string) (reservation, error) {
+	var res reservation
+	for i, name := range header {
+		if i >= len(record) {
+			break
+		}
+		value := strings.TrimSpace(record[i])
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "mac":
+			res.MAC = value
+		case "ipv4":
+			res.IPv4 = value
+		case "hostname":
+			res.Hostname = value
+		case "lease_time":
+			res.LeaseTime = value
+		case "tags":
+			res.Tags = splitCSVList(value)
+		case "macs":
+			res.MACs = splitCSVList(value)
+		case "client_id":
+			res.ClientID = value
+		case "match_tags":
+			res.MatchTags = splitCSVList(value)
+		case "ipv6":
+			res.IPv6 = splitCSVList(value)
+		case "ignore":
+			res.Ignore = value == "true"
+		case "description":
+			res.Description = value
+		case "owner":
+			res.Owner = value
+		case "asset_id":
+			res.AssetID = value
+		case "expires_at":
+			if value != "" {
+				expiresAt, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return res, fmt.Errorf("invalid expires_at: %v", err)
 				}
+				res.ExpiresAt = &expiresAt
 			}
-			return nil
-		})
+		case "on_expiry":
+			res.OnExpiry = value
+		}
+	}
+	return res, nil
+}
+
+// splitCSVList splits a comma-separated list in a CSV field, dropping empty items.
+func splitCSVList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// reservationToCSV returns the reservation as a record in the order of reservationCSVHeader.
+func reservationToCSV(res reservation) []string {
+	ignore, expiresAt := "", ""
+	if res.Ignore {
+		ignore = "true"
+	}
+	if res.ExpiresAt != nil {
+		expiresAt = res.ExpiresAt.Format(time.RFC3339)
+	}
+	return []string{
+		res.MAC, res.IPv4, res.Hostname, res.LeaseTime, strings.Join(res.Tags, ","),
+		strings.Join(res.MACs, ","), res.ClientID, strings.Join(res.MatchTags, ","), strings.Join(res.IPv6, ","), ignore,
+		res.Description, res.Owner, res.AssetID, expiresAt, res.OnExpiry,
+	}
+}
+
+// decodeReservations reads a JSON array, NDJSON or CSV (with a header) of reservations from body.
+// Errors in individual rows are kept with the row; only errors that stop the decoding are returned.
+func decodeReservations(format string, body io.Reader) ([]importRow, error) {
+	var rows []importRow
+	switch format {
+	case mimeNDJSON:
+		scanner := bufio.NewScanner(body)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			row := importRow{row: line}
+			row.err = json.Unmarshal(scanner.Bytes(), &row.reservation)
+			rows = append(rows, row)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case mimeCSV:
+		reader := csv.NewReader(body)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, fmt.Errorf("invalid CSV header: %v", err)
+		}
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			row := importRow{row: line, err: err}
+			if err == nil {
+				row.reservation, row.err = reservationFromCSV(header, record)
+			} else if _, ok := err.(*csv.ParseError); !ok {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	default:
+		var elements []json.RawMessage
+		if err := json.NewDecoder(body).Decode(&elements); err != nil {
+			return nil, fmt.Errorf("expected a JSON array of reservations: %v", err)
+		}
+		for i, element := range elements {
+			row := importRow{row: i + 1}
+			row.err = json.Unmarshal(element, &row.reservation)
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// importReservations writes every reservation in the request body and reports the result of each row.
+// When the atomic query parameter is true, nothing is written unless every row is valid,
+// and the rows already written are restored when a write fails.
+// Existing reservations are only replaced when the overwrite query parameter is true.
+func importReservations(c *gin.Context, hostDir *hostDirectory) {
+	rows, err := decodeReservations(reservationFormat(c, c.ContentType()), c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	atomic := c.Query("atomic") == "true"
+	force := c.Query("force") == "true"
+	overwrite := c.Query("overwrite") == "true"
+
+	// Hold the directory lock exclusively so the import is not interleaved with other changes
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	existing, err := readReservations(hostDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	index := newReservationIndex(existing)
+
+	type pendingFile struct {
+		index   int
+		name    string
+		content string
+	}
+	var pending []pendingFile
+	results := make([]importResult, len(rows))
+	names := make(map[string]int)
+	failed := 0
+
+	// Validate every row before writing any of them
+	for i, row := range rows {
+		results[i] = importResult{Row: row.row, MAC: row.MAC, Status: http.StatusBadRequest}
+		err := row.err
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&row.reservation)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			failed++
+			continue
+		}
+		name, content, err := formatReservation(row.reservation)
+		if err != nil {
+			results[i].Error = err.Error()
+			results[i].Fields, _ = err.(validationError)
+			failed++
+			continue
+		}
+		results[i].MAC = name
+		if first, exists := names[name]; exists {
+			results[i].Status = http.StatusConflict
+			results[i].Error = fmt.Sprintf("duplicate of row %d", first)
+			failed++
+			continue
+		}
+		names[name] = row.row
+		if _, err := os.Stat(hostDir.filePath(name)); err == nil && !overwrite {
+			results[i].Status = http.StatusConflict
+			results[i].Error = "exists"
+			failed++
+			continue
+		}
+		if err := index.conflict(name, row.reservation); err != nil && !force {
+			results[i].Status = http.StatusConflict
+			results[i].Error = err.Error()
+			results[i].Conflict = err.(*conflictError)
+			failed++
+			continue
+		}
+		index.set(name, row.reservation)
+		pending = append(pending, pendingFile{i, name, content})
+	}
+
+	if atomic && failed > 0 {
+		for _, file := range pending {
+			results[file.index].Status = http.StatusFailedDependency
+			results[file.index].Error = "not imported because other rows failed"
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "import failed validation", "imported": 0, "failed": failed, "results": results})
+		return
+	}
+
+	// Keep the prior content of each file to record it and to restore it if an atomic import fails
+	identity := requestIdentity(c)
+	var changes []reservationChange
+	var undos []func()
+	for _, file := range pending {
+		previous, _ := os.ReadFile(hostDir.filePath(file.name))
+		change := reservationChange{
+			Name: file.name, Operation: "import", Identity: identity, Previous: previous, Content: []byte(file.content),
+			Metadata: &rows[file.index].reservationMetadata,
+		}
+		undo, err := hostDir.stage(change)
+		if err != nil {
+			results[file.index].Status = http.StatusInternalServerError
+			results[file.index].Error = err.Error()
+			failed++
+			if atomic {
+				undoAll(undos)
+				for i := range changes {
+					results[pending[i].index].Status = http.StatusFailedDependency
+					results[pending[i].index].Error = "rolled back because other rows failed"
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "imported": 0, "failed": failed, "results": results})
+				return
+			}
+			continue
 		}
-		c.JSON(http.StatusOK, reservations)
+		changes, undos = append(changes, change), append(undos, undo)
+		results[file.index].Status = http.StatusCreated
+	}
+	if err := hostDir.version(changes); err != nil {
+		undoAll(undos)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"imported": len(rows) - failed, "failed": failed, "results": results})
+}
+
+// exportReservations writes every reservation as a JSON array, NDJSON or CSV.
+func exportReservations(c *gin.Context, hostDir *hostDirectory) {
+	reservations, err := listReservations(hostDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reservations == nil {
+		reservations = []reservation{}
+	}
+	writeList(c, reservations, reservationCSVHeader, reservationToCSV)
 }
 
 func prefixTags(tags []string) []string {
+	prefixed := make([]string, len(tags))
 	for i, tag := range tags {
-		tags[i] = "set:" + tag
+		prefixed[i] = "set:" + tag
 	}
-	return tags
+	return prefixed
 }
 
-func DhcpHostDir(r *gin.Engine, hostDir string) *gin.Engine {
-	r.POST("/reservations", func(c *gin.Context) {
-		var input struct {
-			MAC string `json:"mac" binding:"required"`
-			reservationData
-		}
+func DhcpHostDir(r *gin.Engine, hostDirPath string) *gin.Engine {
+	hostDir := openHostDirectory(hostDirPath)
+	// Load the reservations into memory now rather than on the first request
+	if err := hostDir.cache.use(func(*reservationIndex) {}); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to watch the host directory, reading it for every request instead: %v\n", err)
+	}
 
+	r.POST("/reservations", func(c *gin.Context) {
+		var input reservationInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		createReservationFile(input, c, hostDir, false)
+		if err := input.checkPool(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if input.IPv4 == autoIPv4 {
+			if res, status, err := allocateReservationFile(input.reservation(), input.Pool, hostDir, newWriteOptions(c, false)); err != nil {
+				c.JSON(status, errorResponse(err))
+			} else {
+				c.JSON(status, gin.H{"message": "success", "reservation": res})
+			}
+		} else {
+			createReservationFile(input.reservation(), c, hostDir, false)
+		}
 	})
 
 	r.PUT("/reservations/:mac", func(c *gin.Context) {
@@ -233,6 +755,10 @@ func DhcpHostDir(r *gin.Engine, hostDir string) *gin.Engine {
 		updateReservationFile(input, c.Param("mac"), c, hostDir)
 	})
 
+	r.PATCH("/reservations/:mac", func(c *gin.Context) {
+		patchReservationFile(c, hostDir)
+	})
+
 	r.DELETE("/reservations/:mac", func(c *gin.Context) {
 		deleteReservationFile(c, hostDir)
 	})
@@ -241,9 +767,77 @@ func DhcpHostDir(r *gin.Engine, hostDir string) *gin.Engine {
 		getReservationFile(c, hostDir)
 	})
 
+	r.POST("/reservations/validate", func(c *gin.Context) {
+		validateReservations(c, hostDir)
+	})
+
+	r.GET("/reservations/lint", func(c *gin.Context) {
+		lintReservations(c, hostDir, false)
+	})
+
+	r.POST("/reservations/lint", func(c *gin.Context) {
+		lintReservations(c, hostDir, true)
+	})
+
+	r.GET("/reservations/export", func(c *gin.Context) {
+		exportReservations(c, hostDir)
+	})
+
+	r.POST("/reservations/import", func(c *gin.Context) {
+		importReservations(c, hostDir)
+	})
+
+	r.GET("/reservations/snapshot", func(c *gin.Context) {
+		getSnapshot(c, hostDir)
+	})
+
+	r.POST("/reservations/snapshot", func(c *gin.Context) {
+		restoreSnapshot(c, hostDir)
+	})
+
+	r.GET("/reservations/log", func(c *gin.Context) {
+		getReservationLog(c, hostDir)
+	})
+
 	r.GET("/reservations/:mac", func(c *gin.Context) {
 		getReservationFile(c, hostDir)
 	})
 
+	r.GET("/reservations/:mac/history", func(c *gin.Context) {
+		getReservationHistory(c, hostDir)
+	})
+
+	r.POST("/reservations/:mac/restore", func(c *gin.Context) {
+		restoreReservationFile(c, hostDir)
+	})
+
+	r.GET(replicationPath, func(c *gin.Context) {
+		getReplicaFiles(c, hostDir)
+	})
+
+	r.POST(replicationPath, func(c *gin.Context) {
+		postReplicaFiles(c, hostDir)
+	})
+
+	r.GET("/replication/status", func(c *gin.Context) {
+		getReplicationStatus(c, hostDir)
+	})
+
+	r.GET("/tags", func(c *gin.Context) {
+		listTags(c, hostDir)
+	})
+
+	r.GET("/tags/:tag", func(c *gin.Context) {
+		listTagMembers(c, hostDir)
+	})
+
+	r.PUT("/tags/:tag/members/:mac", func(c *gin.Context) {
+		setTagMember(c, hostDir, true)
+	})
+
+	r.DELETE("/tags/:tag/members/:mac", func(c *gin.Context) {
+		setTagMember(c, hostDir, false)
+	})
+
 	return r
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/seancfoley/ipaddress-go/ipaddr"
+)
+
+// autoIPv4 is the IPv4 address that asks for the next free address in a pool.
+const autoIPv4 = "auto"
+
+// errPoolExhausted reports that every address in the pool is reserved or leased.
+var errPoolExhausted = fmt.Errorf("no free address in pool")
+
+// poolAddresses returns the IPv4 addresses of the pool, a CIDR or range as in /requests, lowest first.
+// The network and broadcast addresses of a CIDR are left out.
+func poolAddresses(pool string) (ipaddr.Iterator[*ipaddr.IPAddress], map[string]bool, error) {
+	addr, err := ipaddr.NewIPAddressString(pool).ToAddress()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !addr.IsIPv4() {
+		return nil, nil, fmt.Errorf("'%s' is not IPv4", pool)
+	}
+	excluded := make(map[string]bool)
+	if addr.IsPrefixed() && addr.GetPrefixLen().Len() < 31 {
+		block := addr.ToPrefixBlock().WithoutPrefixLen()
+		excluded[block.GetLower().String()] = true
+		excluded[block.GetUpper().String()] = true
+	}
+	return addr.WithoutPrefixLen().Iterator(), excluded, nil
+}
+
+// allocateIPv4 returns the lowest address in the pool that no other MAC reserves or leases.
+func allocateIPv4(pool, mac string, idx *reservationIndex, leases map[string]string) (string, error) {
+	addresses, excluded, err := poolAddresses(pool)
+	if err != nil {
+		return "", err
+	}
+	for addresses.HasNext() {
+		ipv4 := addresses.Next().String()
+		if excluded[ipv4] {
+			continue
+		}
+		if holder, reserved := idx.ipv4[ipv4]; reserved && holder != mac {
+			continue
+		}
+		if holder, leased := leases[ipv4]; leased && holder != mac {
+			continue
+		}
+		return ipv4, nil
+	}
+	return "", errPoolExhausted
+}
+
+// allocateReservationFile sets the IPv4 address of the input to the next free address in the pool and writes it.
+// It holds the directory lock throughout so no other change can take the same address.
+func allocateReservationFile(input reservation, pool string, hostDir *hostDirectory, opts writeOptions) (reservation, int, error) {
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	reservations, err := readReservations(hostDir)
+	if err != nil {
+		return input, http.StatusInternalServerError, err
+	}
+	input, status, err := allocateReservation(input, pool, hostDir, newReservationIndex(reservations))
+	if err != nil {
+		return input, status, err
+	}
+	status, err = storeReservationFile(input, hostDir, opts)
+	return input, status, err
+}
+
+// allocateReservation sets the IPv4 address of the input to the next free address in the pool.
+// The caller must hold the directory lock.
+func allocateReservation(input reservation, pool string, hostDir *hostDirectory, idx *reservationIndex) (reservation, int, error) {
+	mac, err := validateMAC(input.MAC)
+	if err != nil {
+		return input, http.StatusBadRequest, validationError{{Field: "mac", Value: input.MAC, Error: "invalid MAC address"}}
+	}
+	leases, err := hostDir.leasedAddresses()
+	if err != nil {
+		return input, http.StatusInternalServerError, err
+	}
+	input.IPv4, err = allocateIPv4(pool, mac.ToNormalizedString(), idx, leases)
+	if err == errPoolExhausted {
+		return input, http.StatusConflict, err
+	} else if err != nil {
+		return input, http.StatusBadRequest, fmt.Errorf("invalid pool: %v", err)
+	}
+	return input, http.StatusOK, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllocateIPv4(t *testing.T) {
+	idx := newReservationIndex([]reservation{
+		{MAC: "00:1a:2b:3c:4d:5e", reservationData: reservationData{IPv4: "192.168.1.9"}},
+	})
+	leases := map[string]string{"192.168.1.10": "00:1a:2b:3c:4d:5f"}
+
+	// The network address, the reserved and the leased addresses are skipped
+	_, err := allocateIPv4("192.168.1.8/30", "00:1a:2b:3c:4d:60", idx, leases)
+	assert.ErrorIs(t, err, errPoolExhausted)
+
+	// The MAC may take the address it reserves or leases itself
+	ipv4, err := allocateIPv4("192.168.1.8/30", "00:1a:2b:3c:4d:5e", idx, leases)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.9", ipv4)
+
+	ipv4, err = allocateIPv4("192.168.1.9-12", "00:1a:2b:3c:4d:60", idx, leases)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.11", ipv4)
+
+	_, err = allocateIPv4("fe80::/64", "00:1a:2b:3c:4d:60", idx, leases)
+	assert.Error(t, err)
+}
+
+func TestCreateReservationWithAutoIPv4(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	for i, expected := range []struct {
+		code int
+		ipv4 string
+	}{
+		{http.StatusCreated, "192.168.1.1"},
+		{http.StatusCreated, "192.168.1.2"},
+		{http.StatusConflict, ""},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(
+			`{"mac": "00:1A:2B:3C:4D:5`+string(rune('0'+i))+`", "ipv4": "auto", "pool": "192.168.1.0/30"}`,
+		))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, expected.code, w.Code)
+
+		var response struct {
+			Reservation reservation `json:"reservation"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, expected.ipv4, response.Reservation.IPv4)
+	}
+}
+
+func TestCreateReservationWithAutoIPv4AvoidsLeases(t *testing.T) {
+	r := setupRouterForLeaseReservationTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "auto", "pool": "192.168.1.9-20"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"ipv4":"192.168.1.10"`)
+}
+
+func TestCreateReservationWithAutoIPv4Invalid(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	for _, body := range []string{
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "auto"}`,
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.1", "pool": "192.168.1.0/24"}`,
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "auto", "pool": "invalid"}`,
+		`{"mac": "invalid", "ipv4": "auto", "pool": "192.168.1.0/24"}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
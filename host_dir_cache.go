@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// reservationCache keeps the reservations in a host directory in memory.
+// Before each use, it applies the changes inotify reports, so edits made outside the API show up at once.
+type reservationCache struct {
+	mu        sync.Mutex
+	hostDir   *hostDirectory
+	directory watchedDirectory
+	index     *reservationIndex // nil until loaded
+}
+
+func newReservationCache(hostDir *hostDirectory) *reservationCache {
+	return &reservationCache{hostDir: hostDir, directory: watchedDirectory{path: hostDir.path}}
+}
+
+// use calls f with the index of the reservations after bringing it up to date.
+// It returns an error without calling f when the directory cannot be watched.
+func (rc *reservationCache) use(f func(idx *reservationIndex)) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if err := rc.refresh(); err != nil {
+		rc.index = nil
+		return err
+	}
+	f(rc.index)
+	return nil
+}
+
+// refresh loads the directory the first time, or again when events were lost or it was replaced,
+// and otherwise reads the files that changed since the last refresh.
+func (rc *reservationCache) refresh() error {
+	return rc.directory.refresh(func() error {
+		idx, err := scanReservations(rc.hostDir)
+		if err == nil {
+			rc.index = idx
+		}
+		return err
+	}, func(name string) error {
+		rc.reload(name)
+		return nil
+	})
+}
+
+// reload reads the named file into the index or removes it when it is gone or not a reservation.
+func (rc *reservationCache) reload(name string) {
+	if mac, err := validateMAC(name); err != nil || mac.ToNormalizedString() != name || ignoredByDnsmasq(name) {
+		return
+	}
+	if res, err := readReservationFile(name, rc.hostDir); err == nil {
+		rc.index.set(name, res)
+	} else {
+		rc.index.remove(name)
+	}
+}
+
+// sortedNames returns the file names, i.e., normalized MACs, of the indexed reservations in order.
+func (idx *reservationIndex) sortedNames() []string {
+	names := make([]string, 0, len(idx.mac))
+	for name := range idx.mac {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedReservations returns the reservations in the index ordered by MAC.
+func (idx *reservationIndex) sortedReservations() []reservation {
+	names := idx.sortedNames()
+	reservations := make([]reservation, len(names))
+	for i, name := range names {
+		reservations[i] = idx.mac[name]
+	}
+	return reservations
+}
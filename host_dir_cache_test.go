@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listTestReservations(t *testing.T, url string) []reservation {
+	r := setupRouterForReservationsTests()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var reservations []reservation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reservations))
+	return reservations
+}
+
+func TestReservationCacheExternalEdits(t *testing.T) {
+	defer removeTestHostDir()
+	assert.Empty(t, listTestReservations(t, "/reservations"))
+
+	// Files written, changed and removed outside the API show up at once
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e", []byte("00:1a:2b:3c:4d:5e,192.168.1.100,host1\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5f", []byte("00:1a:2b:3c:4d:5f,192.168.1.101,host2\n"), 0644)
+	reservations := listTestReservations(t, "/reservations")
+	assert.Len(t, reservations, 2)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", reservations[0].MAC)
+
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e", []byte("00:1a:2b:3c:4d:5e,192.168.1.102,host1\n"), 0644)
+	os.Rename("./test_hosts/00:1a:2b:3c:4d:5f", "./test_hosts/.00:1a:2b:3c:4d:5f")
+	reservations = listTestReservations(t, "/reservations")
+	assert.Len(t, reservations, 1)
+	assert.Equal(t, "192.168.1.102", reservations[0].IPv4)
+
+	// The directory is watched again after it is replaced
+	removeTestHostDir()
+	os.Mkdir("./test_hosts", 0755)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:60", []byte("00:1a:2b:3c:4d:60,192.168.1.103\n"), 0644)
+	reservations = listTestReservations(t, "/reservations")
+	assert.Len(t, reservations, 1)
+	assert.Equal(t, "00:1a:2b:3c:4d:60", reservations[0].MAC)
+}
+
+func TestLookupReservations(t *testing.T) {
+	defer removeTestHostDir()
+	setupRouterForReservationsTests()
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e", []byte("00:1a:2b:3c:4d:5e,192.168.1.100,host1\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5f", []byte("00:1a:2b:3c:4d:5f,192.168.1.101,host2\n"), 0644)
+
+	reservations := listTestReservations(t, "/reservations?ipv4=192.168.1.101")
+	assert.Len(t, reservations, 1)
+	assert.Equal(t, "host2", reservations[0].Hostname)
+
+	reservations = listTestReservations(t, "/reservations?hostname=HOST1")
+	assert.Len(t, reservations, 1)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", reservations[0].MAC)
+
+	assert.Len(t, listTestReservations(t, "/reservations?ipv4=192.168.1.100&hostname=host1"), 1)
+	assert.Empty(t, listTestReservations(t, "/reservations?ipv4=192.168.1.100&hostname=host2"))
+	assert.Empty(t, listTestReservations(t, "/reservations?ipv4=192.168.1.200"))
+}
+
+func TestReservationIndexRemoveDuplicate(t *testing.T) {
+	idx := newReservationIndex([]reservation{
+		{MAC: "00:1a:2b:3c:4d:5e", reservationData: reservationData{IPv4: "192.168.1.100", Hostname: "host1"}},
+		{MAC: "00:1a:2b:3c:4d:5f", reservationData: reservationData{IPv4: "192.168.1.100", Hostname: "host1"}},
+	})
+	idx.remove(idx.ipv4["192.168.1.100"])
+
+	assert.Len(t, idx.mac, 1)
+	for mac := range idx.mac {
+		assert.Equal(t, mac, idx.ipv4["192.168.1.100"])
+		assert.Equal(t, mac, idx.hostname["host1"])
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	expiryDelete = "delete"
+	expiryIgnore = "ignore"
+	// expiryInterval is how often ExpireReservations looks for expired reservations.
+	expiryInterval = time.Minute
+	// expiryIdentity is the identity recorded in the history of an expired reservation.
+	expiryIdentity = "expiry"
+)
+
+// expired reports whether the reservation has an expiry time that is not after now.
+func (m reservationMetadata) expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+// expireReservation returns the change that expires the reservation whose file has the content.
+// It removes the file or, when the reservation is to be ignored, keeps it with ignore set and its expiry cleared.
+func expireReservation(name string, res reservation, content []byte) (reservationChange, error) {
+	change := reservationChange{Name: name, Operation: "expire", Identity: expiryIdentity, Previous: content}
+	if res.OnExpiry != expiryIgnore {
+		return change, nil
+	}
+	res.Ignore = true
+	res.ExpiresAt, res.OnExpiry = nil, ""
+	_, line, err := formatReservation(res)
+	if err != nil {
+		return change, err
+	}
+	change.Content = []byte(line)
+	change.Metadata = &res.reservationMetadata
+	return change, nil
+}
+
+// expireReservations expires every reservation in hostDir whose expiry time is not after now
+// and returns the names of those it expired.
+// A reservation that cannot be expired does not hold up the others; the error names each that failed.
+// It holds the directory lock exclusively so no other change is made while it runs.
+func expireReservations(hostDir *hostDirectory, now time.Time) ([]string, error) {
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	reservations, err := readReservations(hostDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := hostDir.metadata.attach(reservations); err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	var errs []error
+	for _, res := range reservations {
+		if !res.expired(now) {
+			continue
+		}
+		mac, err := validateMAC(res.MAC)
+		if err != nil {
+			continue
+		}
+		name := mac.ToNormalizedString()
+		content, err := os.ReadFile(hostDir.filePath(name))
+		if err == nil {
+			var change reservationChange
+			if change, err = expireReservation(name, res, content); err == nil {
+				err = hostDir.commit(change)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		expired = append(expired, name)
+	}
+	return expired, errors.Join(errs...)
+}
+
+// ExpireReservations expires the reservations in the host directory as their expiry times pass.
+// It checks every expiryInterval and never returns; failures are reported and retried at the next check.
+func ExpireReservations(hostDirPath string) {
+	hostDir := openHostDirectory(hostDirPath)
+	for now := range time.Tick(expiryInterval) {
+		if _, err := expireReservations(hostDir, now); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to expire reservations: %v\n", err)
+		}
+	}
+}
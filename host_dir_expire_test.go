@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpireReservations(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, body := range []string{
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "expires_at": "` + now.Add(time.Hour).Format(time.RFC3339) + `"}`,
+		`{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.101", "expires_at": "` + now.Add(2*time.Hour).Format(time.RFC3339) + `", "on_expiry": "ignore"}`,
+		`{"mac": "00:1A:2B:3C:4D:60", "ipv4": "192.168.1.102"}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	// Pending expirations, as a duration from now or a time
+	reservations := listTestReservations(t, "/reservations?expiring_before=90m")
+	assert.Len(t, reservations, 1)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", reservations[0].MAC)
+	reservations = listTestReservations(t, "/reservations?expiring_before="+now.Add(3*time.Hour).Format(time.RFC3339)+"&sort=expires_at&order=desc")
+	assert.Len(t, reservations, 2)
+	assert.Equal(t, "00:1a:2b:3c:4d:5f", reservations[0].MAC)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations?expiring_before=tomorrow", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	expired, err := expireReservations(openHostDirectory("./test_hosts"), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"00:1a:2b:3c:4d:5e"}, expired)
+	assert.NoFileExists(t, "./test_hosts/00:1a:2b:3c:4d:5e")
+	assert.NoFileExists(t, "./test_hosts.meta/00:1a:2b:3c:4d:5e")
+
+	expired, err = expireReservations(openHostDirectory("./test_hosts"), now.Add(3*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"00:1a:2b:3c:4d:5f"}, expired)
+	content, _ := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:5f")
+	assert.Equal(t, "00:1a:2b:3c:4d:5f,192.168.1.101,ignore\n", string(content))
+	assert.Empty(t, listTestReservations(t, "/reservations?expiring_before=1000h"))
+	assert.Len(t, listTestReservations(t, "/reservations"), 2)
+
+	// Each expiry is recorded
+	for _, mac := range []string{"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/reservations/"+mac+"/history", nil)
+		r.ServeHTTP(w, req)
+		var entries []historyEntry
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "expire", entries[1].Operation)
+		assert.Equal(t, expiryIdentity, entries[1].Identity)
+	}
+}
+
+func TestInvalidOnExpiry(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "on_expiry": "disable"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"on_expiry"`)
+}
+
+func TestExpireReservationsPastFailure(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expiresAt := now.Add(time.Hour).Format(time.RFC3339)
+	for _, body := range []string{
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "expires_at": "` + expiresAt + `"}`,
+		`{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.101", "expires_at": "` + expiresAt + `"}`,
+	} {
+		assert.Equal(t, http.StatusCreated, sendTestRequest(r, "POST", "/reservations", "", body).Code)
+	}
+	// The expiry of the first cannot be recorded when its history is a directory
+	assert.NoError(t, os.Remove("./test_hosts.history/00:1a:2b:3c:4d:5e"))
+	assert.NoError(t, os.Mkdir("./test_hosts.history/00:1a:2b:3c:4d:5e", 0755))
+
+	expired, err := expireReservations(openHostDirectory("./test_hosts"), now.Add(time.Hour))
+	assert.ErrorContains(t, err, "00:1a:2b:3c:4d:5e")
+	assert.Equal(t, []string{"00:1a:2b:3c:4d:5f"}, expired)
+	assert.FileExists(t, "./test_hosts/00:1a:2b:3c:4d:5e")
+	assert.NoFileExists(t, "./test_hosts/00:1a:2b:3c:4d:5f")
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostDirectory is a dhcp-host files directory that serializes the changes made to it.
+// Files are replaced atomically so Dnsmasq never reads one that is partially written.
+// The history and metadata stores live beside the directory, not in it, so Dnsmasq never reads them.
+type hostDirectory struct {
+	path        string
+	mu          sync.RWMutex // held exclusively to write files, since they must not conflict, and shared to delete or read them
+	locks       sync.Map     // a *sync.Mutex for each file name, i.e., normalized MAC
+	history     *historyStore
+	metadata    *metadataStore
+	cache       *reservationCache
+	leases      func() (map[string]string, error) // the MAC leasing each IPv4 address, from the lease database or file
+	git         *gitRepository                    // commits each change when the directory is a git work tree
+	replication *replicator                       // pushes the reservations to or pulls them from a peer
+}
+
+func newHostDirectory(path string) *hostDirectory {
+	hostDir := &hostDirectory{path: path, history: newHistoryStore(path), metadata: newMetadataStore(path)}
+	hostDir.cache = newReservationCache(hostDir)
+	return hostDir
+}
+
+// hostDirectories holds the hostDirectory of each path so every set of routes that changes it shares its locks.
+var hostDirectories sync.Map
+
+// openHostDirectory returns the hostDirectory for the path, creating it the first time.
+func openHostDirectory(path string) *hostDirectory {
+	hostDir, _ := hostDirectories.LoadOrStore(filepath.Clean(path), newHostDirectory(path))
+	return hostDir.(*hostDirectory)
+}
+
+// leasedAddresses returns the MAC that leases each IPv4 address or nil when there is no lease database or file.
+func (hd *hostDirectory) leasedAddresses() (map[string]string, error) {
+	if hd.leases == nil {
+		return nil, nil
+	}
+	return hd.leases()
+}
+
+// withIndex calls f with the index of the reservations in the directory.
+// It uses the cache and falls back to reading every file when the directory cannot be watched.
+func (hd *hostDirectory) withIndex(f func(idx *reservationIndex)) error {
+	if err := hd.cache.use(f); err == nil {
+		return nil
+	}
+	idx, err := scanReservations(hd)
+	if err != nil {
+		return err
+	}
+	f(idx)
+	return nil
+}
+
+// filePath returns the path of the named file in the directory.
+func (hd *hostDirectory) filePath(name string) string {
+	return filepath.Join(hd.path, name)
+}
+
+// lockFile locks the named file and returns the function that unlocks it.
+func (hd *hostDirectory) lockFile(name string) func() {
+	lock, _ := hd.locks.LoadOrStore(name, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// writeFile replaces the named file with content by writing it to a temporary file,
+// syncing it and renaming it into place.
+// The temporary file name starts with a dot so Dnsmasq ignores it.
+func (hd *hostDirectory) writeFile(name string, content []byte) error {
+	tmp, err := os.CreateTemp(hd.path, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0640); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), hd.filePath(name)); err != nil {
+		return err
+	}
+	return hd.sync()
+}
+
+// commit makes the change and commits it when the directory is a git work tree.
+func (hd *hostDirectory) commit(change reservationChange) error {
+	return hd.commitAll([]reservationChange{change})
+}
+
+// commitAll makes the changes and commits them, and the other named files, together. When one fails, those
+// already made are undone so they are all made or none is.
+func (hd *hostDirectory) commitAll(changes []reservationChange, names ...string) error {
+	var undos []func()
+	for _, change := range changes {
+		undo, err := hd.stage(change)
+		if err != nil {
+			undoAll(undos)
+			return err
+		}
+		undos = append(undos, undo)
+	}
+	if err := hd.version(changes, names...); err != nil {
+		undoAll(undos)
+		return err
+	}
+	return nil
+}
+
+// stage stores the metadata of the change, writes its content, or removes the file when it has none, and records
+// it in the history. It returns a function that undoes all three, and undoes them itself when one fails.
+func (hd *hostDirectory) stage(change reservationChange) (func(), error) {
+	metadata, err := hd.metadata.get(change.Name)
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := hd.history.size(change.Name)
+	if err != nil {
+		return nil, err
+	}
+	undo := func() {
+		var errs []error
+		if change.Previous != nil {
+			errs = append(errs, hd.writeFile(change.Name, change.Previous))
+		} else if err := hd.removeFile(change.Name); !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		if metadata.empty() {
+			errs = append(errs, hd.metadata.delete(change.Name))
+		} else {
+			errs = append(errs, hd.metadata.set(change.Name, metadata))
+		}
+		errs = append(errs, hd.history.truncate(change.Name, recorded))
+		if err := errors.Join(errs...); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to undo the change of %s: %v\n", change.Name, err)
+		}
+	}
+
+	// The metadata is stored first so a reservation is never written without it
+	if err := hd.storeMetadata(change); err != nil {
+		undo()
+		return nil, err
+	}
+	if change.Content == nil {
+		err = hd.removeFile(change.Name)
+	} else {
+		err = hd.writeFile(change.Name, change.Content)
+	}
+	if err == nil {
+		err = hd.history.record(change)
+	}
+	if err != nil {
+		undo()
+		return nil, err
+	}
+	return undo, nil
+}
+
+// undoAll undoes the changes, the last first.
+func undoAll(undos []func()) {
+	for i := len(undos) - 1; i >= 0; i-- {
+		undos[i]()
+	}
+}
+
+// storeMetadata replaces the metadata of the reservation with that of the change.
+func (hd *hostDirectory) storeMetadata(change reservationChange) error {
+	if change.Content == nil {
+		return hd.metadata.delete(change.Name)
+	} else if change.Metadata != nil {
+		meta := *change.Metadata
+		if meta.CreatedAt == nil && change.Previous == nil {
+			now := time.Now().UTC()
+			meta.CreatedAt = &now
+		}
+		return hd.metadata.set(change.Name, meta)
+	}
+	return nil
+}
+
+// entityTag returns the entity tag of the named reservation with the content, which covers its metadata too.
+func (hd *hostDirectory) entityTag(name string, content []byte) string {
+	meta, err := hd.metadata.get(name)
+	if err != nil || meta.empty() {
+		return entityTag(content)
+	}
+	encoded, _ := json.Marshal(meta)
+	return entityTag(append(append([]byte{}, content...), encoded...))
+}
+
+// version commits the files of the changes, and the other named files, when the directory is a git work tree.
+func (hd *hostDirectory) version(changes []reservationChange, names ...string) error {
+	if hd.git == nil || len(changes) == 0 {
+		return nil
+	}
+	for _, change := range changes {
+		names = append(names, change.Name)
+	}
+	if err := hd.git.commit(gitCommitMessage(changes), names...); err != nil {
+		return fmt.Errorf("unable to commit %s: %v", strings.Join(names, ", "), err)
+	}
+	return nil
+}
+
+// removeFile removes the named file and makes the removal durable.
+func (hd *hostDirectory) removeFile(name string) error {
+	if err := os.Remove(hd.filePath(name)); err != nil {
+		return err
+	}
+	return hd.sync()
+}
+
+// sync flushes the directory entries so renames and removals survive a crash.
+func (hd *hostDirectory) sync() error {
+	dir, err := os.Open(hd.path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostDirectoryWriteFile(t *testing.T) {
+	hostDir := newHostDirectory(t.TempDir())
+
+	assert.NoError(t, hostDir.writeFile("00:1a:2b:3c:4d:5e", []byte("first\n")))
+	assert.NoError(t, hostDir.writeFile("00:1a:2b:3c:4d:5e", []byte("second\n")))
+
+	content, err := os.ReadFile(hostDir.filePath("00:1a:2b:3c:4d:5e"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second\n", string(content))
+
+	info, err := os.Stat(hostDir.filePath("00:1a:2b:3c:4d:5e"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(hostDir.path)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestHostDirectoryCommitUndo(t *testing.T) {
+	hostDir := newHostDirectory(t.TempDir() + "/hosts")
+	assert.NoError(t, os.Mkdir(hostDir.path, 0755))
+	name := "00:1a:2b:3c:4d:5e"
+	assert.NoError(t, hostDir.writeFile(name, []byte("first\n")))
+	// The history of the file cannot be recorded when it is a directory
+	assert.NoError(t, os.MkdirAll(hostDir.history.path+"/"+name, 0755))
+
+	err := hostDir.commit(reservationChange{
+		Name: name, Operation: "update", Previous: []byte("first\n"), Content: []byte("second\n"),
+		Metadata: &reservationMetadata{Owner: "someone"},
+	})
+	assert.Error(t, err)
+
+	// Neither the file nor its metadata changed
+	content, err := os.ReadFile(hostDir.filePath(name))
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(content))
+	meta, err := hostDir.metadata.get(name)
+	assert.NoError(t, err)
+	assert.True(t, meta.empty())
+}
+
+func TestConcurrentReservationUpdates(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(
+				fmt.Sprintf(`{"ipv4": "192.168.1.%d", "hostname": "host%d"}`, i, i),
+			))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusCreated, w.Code)
+		}(i)
+	}
+	wg.Wait()
+
+	content, err := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:5e")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^00:1a:2b:3c:4d:5e,192\.168\.1\.(\d+),host(\d+)\n$`, string(content))
+
+	entries, err := os.ReadDir("./test_hosts")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
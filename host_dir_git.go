@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const (
+	// gitAuthor is the author of every commit; the message names who made the change.
+	gitAuthor = "dnsmasq-web"
+	// defaultLogLimit is the number of commits GET /reservations/log returns unless limit is set.
+	defaultLogLimit = 20
+)
+
+// gitRepository commits the changes made to a host directory that is a git work tree.
+type gitRepository struct {
+	mu   sync.Mutex // serializes the changes to the index
+	repo *git.Repository
+}
+
+// gitLogEntry is one commit to the host directory.
+type gitLogEntry struct {
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+// openGitRepository opens the git work tree at path or, when there is none, creates it
+// and commits the reservations already in the directory.
+func openGitRepository(path string) (*gitRepository, error) {
+	repo, err := git.PlainOpen(path)
+	if err == nil {
+		return &gitRepository{repo: repo}, nil
+	} else if !errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, err
+	}
+
+	if repo, err = git.PlainInit(path, false); err != nil {
+		return nil, err
+	}
+	gr := &gitRepository{repo: repo}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !ignoredByDnsmasq(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return gr, gr.commit("add the existing reservations", names...)
+}
+
+// commit stages the named files, adding those that exist and removing the others, and commits them with the message.
+// Nothing is committed when no file changed, and nothing stays staged when the commit fails.
+func (gr *gitRepository) commit(message string, names ...string) error {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	worktree, err := gr.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = worktree.AddWithOptions(&git.AddOptions{Path: name, SkipStatus: true})
+		if err != nil && !errors.Is(err, index.ErrEntryNotFound) {
+			break
+		}
+		err = nil
+	}
+	if err == nil {
+		_, err = worktree.Commit(message, &git.CommitOptions{
+			Author: &object.Signature{Name: gitAuthor, When: time.Now()},
+		})
+	}
+	if errors.Is(err, git.ErrEmptyCommit) {
+		return nil
+	} else if err != nil {
+		// Unstage the files so they are not in the next commit when the changes are undone
+		worktree.Reset(&git.ResetOptions{Files: names})
+	}
+	return err
+}
+
+// log returns up to limit commits, newest first, that change the named file or any file when name is empty.
+func (gr *gitRepository) log(name string, limit int) ([]gitLogEntry, error) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	entries := []gitLogEntry{}
+	options := &git.LogOptions{Order: git.LogOrderCommitterTime}
+	if name != "" {
+		options.FileName = &name
+	}
+	commits, err := gr.repo.Log(options)
+	if err != nil {
+		if _, headErr := gr.repo.Head(); headErr != nil {
+			return entries, nil // no commits yet
+		}
+		return nil, err
+	}
+	defer commits.Close()
+
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if len(entries) == limit {
+			return storer.ErrStop
+		}
+		entries = append(entries, gitLogEntry{
+			Hash: commit.Hash.String(), Timestamp: commit.Author.When, Message: strings.TrimSpace(commit.Message),
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// gitCommitMessage returns the message naming the operation, the MAC and the caller of the changes.
+func gitCommitMessage(changes []reservationChange) string {
+	var message string
+	if len(changes) == 1 {
+		message = fmt.Sprintf("%s %s", changes[0].Operation, changes[0].Name)
+	} else {
+		message = fmt.Sprintf("%s %d reservations", changes[0].Operation, len(changes))
+	}
+	if changes[0].Identity != "" {
+		message += " by " + changes[0].Identity
+	}
+	if len(changes) > 1 {
+		names := make([]string, len(changes))
+		for i, change := range changes {
+			names[i] = change.Name
+		}
+		message += "\n\n" + strings.Join(names, "\n")
+	}
+	return message
+}
+
+// GitHostDir makes every change to the host directory a commit to the git work tree in it, creating it if needed.
+func GitHostDir(hostDirPath string) error {
+	repo, err := openGitRepository(hostDirPath)
+	if err != nil {
+		return err
+	}
+	openHostDirectory(hostDirPath).git = repo
+	return nil
+}
+
+// getReservationLog responds with the recent commits to the host directory, or those of the reservation named by mac.
+func getReservationLog(c *gin.Context, hostDir *hostDirectory) {
+	if hostDir.git == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the log requires a git host directory (-G)"})
+		return
+	}
+	name := ""
+	if c.Query("mac") != "" {
+		mac, err := validateMAC(c.Query("mac"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid MAC address"})
+			return
+		}
+		name = mac.ToNormalizedString()
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+		return
+	}
+
+	entries, err := hostDir.git.log(name, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeList(c, entries, []string{"hash", "timestamp", "message"}, func(entry gitLogEntry) []string {
+		return []string{entry.Hash, entry.Timestamp.Format(time.RFC3339), entry.Message}
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestReservationLog(t *testing.T, url string) []gitLogEntry {
+	r := setupRouterForReservationsTests()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var entries []gitLogEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	return entries
+}
+
+func TestGitHostDir(t *testing.T) {
+	os.Mkdir("./test_hosts", 0755)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:60", []byte("00:1a:2b:3c:4d:60,192.168.1.102\n"), 0644)
+	assert.NoError(t, GitHostDir("./test_hosts"))
+	defer func() {
+		openHostDirectory("./test_hosts").git = nil
+		removeTestHostDir()
+	}()
+	r := setupRouterForReservationsTests()
+
+	for _, request := range []struct{ method, url, body string }{
+		{"POST", "/reservations", `{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100"}`},
+		{"PUT", "/reservations/00:1A:2B:3C:4D:5E", `{"ipv4": "192.168.1.101"}`},
+		{"PUT", "/reservations/00:1A:2B:3C:4D:5E", `{"ipv4": "192.168.1.101"}`}, // unchanged, so not committed
+		{"POST", "/reservations", `{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.103"}`},
+		{"DELETE", "/reservations/00:1A:2B:3C:4D:5E", ""},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(request.method, request.url, strings.NewReader(request.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Less(t, w.Code, 300)
+	}
+
+	entries := getTestReservationLog(t, "/reservations/log")
+	var messages []string
+	for _, entry := range entries {
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{
+		"delete 00:1a:2b:3c:4d:5e",
+		"create 00:1a:2b:3c:4d:5f",
+		"update 00:1a:2b:3c:4d:5e",
+		"create 00:1a:2b:3c:4d:5e",
+		"add the existing reservations",
+	}, messages)
+
+	entries = getTestReservationLog(t, "/reservations/log?mac=00-1A-2B-3C-4D-5E&limit=2")
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "delete 00:1a:2b:3c:4d:5e", entries[0].Message)
+	assert.Equal(t, "update 00:1a:2b:3c:4d:5e", entries[1].Message)
+
+	// The work tree is clean and the repository is not a reservation
+	worktree, _ := openHostDirectory("./test_hosts").git.repo.Worktree()
+	status, err := worktree.Status()
+	assert.NoError(t, err)
+	assert.True(t, status.IsClean())
+	assert.Len(t, listTestReservations(t, "/reservations"), 2)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations/lint", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "[]", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/log?limit=0", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReservationLogWithoutGit(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations/log", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
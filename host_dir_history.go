@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reservationChange describes a change made to a reservation file through the API.
+type reservationChange struct {
+	Name      string               // the file name, i.e., the normalized MAC
+	Operation string               // create, update, patch, delete, import, restore, expire, snapshot or replicate
+	Identity  string               // who made the change
+	Previous  []byte               // the content before the change or nil when there was no file
+	Content   []byte               // the content after the change or nil when the file was removed
+	Metadata  *reservationMetadata // the metadata after the change or nil to keep it
+}
+
+// historyEntry is one version of a reservation file.
+type historyEntry struct {
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	Identity  string    `json:"identity,omitempty"`
+	Content   string    `json:"content"` // empty when the reservation was deleted
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+// historyStore keeps every version of each reservation file in an NDJSON file named by its MAC.
+type historyStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// newHistoryStore returns the history store for the host directory, i.e., the directory named host-dir.history.
+func newHistoryStore(hostDirPath string) *historyStore {
+	return &historyStore{path: filepath.Clean(hostDirPath) + ".history"}
+}
+
+// entries returns every version of the named reservation file, oldest first.
+func (hs *historyStore) entries(name string) ([]historyEntry, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	return hs.read(name)
+}
+
+func (hs *historyStore) read(name string) ([]historyEntry, error) {
+	file, err := os.Open(filepath.Join(hs.path, name))
+	if os.IsNotExist(err) {
+		return []historyEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []historyEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid history for %s: %v", name, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// deletions returns when each reservation file whose last version is a deletion was deleted.
+func (hs *historyStore) deletions() (map[string]time.Time, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	deleted := make(map[string]time.Time)
+	files, err := os.ReadDir(hs.path)
+	if os.IsNotExist(err) {
+		return deleted, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || ignoredByDnsmasq(file.Name()) {
+			continue
+		}
+		entries, err := hs.read(file.Name())
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 && entries[len(entries)-1].Deleted {
+			deleted[file.Name()] = entries[len(entries)-1].Timestamp
+		}
+	}
+	return deleted, nil
+}
+
+// entry returns the given version of the named reservation file.
+func (hs *historyStore) entry(name string, version int) (historyEntry, bool, error) {
+	entries, err := hs.entries(name)
+	if err != nil {
+		return historyEntry{}, false, err
+	}
+	for _, entry := range entries {
+		if entry.Version == version {
+			return entry, true, nil
+		}
+	}
+	return historyEntry{}, false, nil
+}
+
+// record appends the change as the next version.
+// When the last version does not match the content before the change, e.g., because the file was
+// created or edited outside the API, that content is recorded first so it can be restored too.
+func (hs *historyStore) record(change reservationChange) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	entries, err := hs.read(change.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(hs.path, 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(hs.path, change.Name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now().UTC()
+	version := 0
+	encoder := json.NewEncoder(file)
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		version = last.Version
+		if last.Content != string(change.Previous) || last.Deleted != (change.Previous == nil) {
+			version++
+			if err := encoder.Encode(newHistoryEntry(version, now, "external", "", change.Previous)); err != nil {
+				return err
+			}
+		}
+	} else if change.Previous != nil {
+		version++
+		if err := encoder.Encode(newHistoryEntry(version, now, "external", "", change.Previous)); err != nil {
+			return err
+		}
+	}
+	version++
+	if err := encoder.Encode(newHistoryEntry(version, now, change.Operation, change.Identity, change.Content)); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// size returns the size of the history of the named reservation file, to truncate it back to.
+func (hs *historyStore) size(name string) (int64, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	info, err := os.Stat(filepath.Join(hs.path, name))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// truncate removes the versions recorded since the history of the named reservation file had the size.
+func (hs *historyStore) truncate(name string, size int64) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	path := filepath.Join(hs.path, name)
+	if size > 0 {
+		return os.Truncate(path, size)
+	} else if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func newHistoryEntry(version int, timestamp time.Time, operation, identity string, content []byte) historyEntry {
+	return historyEntry{
+		Version:   version,
+		Timestamp: timestamp,
+		Operation: operation,
+		Identity:  identity,
+		Content:   string(content),
+		Deleted:   content == nil,
+	}
+}
+
+func getReservationHistory(c *gin.Context, hostDir *hostDirectory) {
+	mac, err := validateMAC(c.Param("mac"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid MAC address"})
+		return
+	}
+	if entries, err := hostDir.history.entries(mac.ToNormalizedString()); err == nil {
+		writeList(c, entries, []string{"version", "timestamp", "operation", "identity", "content", "deleted"},
+			func(entry historyEntry) []string {
+				return []string{
+					strconv.Itoa(entry.Version), entry.Timestamp.Format(time.RFC3339Nano), entry.Operation, entry.Identity,
+					entry.Content, strconv.FormatBool(entry.Deleted),
+				}
+			})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// restoreReservationFile restores the version of the reservation in the version query parameter.
+// Restoring a deleted version deletes the reservation.
+func restoreReservationFile(c *gin.Context, hostDir *hostDirectory) {
+	mac, err := validateMAC(c.Param("mac"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid MAC address"})
+		return
+	}
+	name := mac.ToNormalizedString()
+	version, err := strconv.Atoi(c.Query("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a version number is required"})
+		return
+	}
+
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	entry, found, err := hostDir.history.entry(name, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such version"})
+		return
+	}
+
+	opts := newWriteOptions(c, true)
+	opts.operation = "restore"
+	if !entry.Deleted {
+		res, err := parseDhcpHost(entry.Content)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// The history only has the files, so the metadata stays as it is
+		if res.reservationMetadata, err = hostDir.metadata.get(name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if status, err := storeReservationFile(res, hostDir, opts); err != nil {
+			c.JSON(status, errorResponse(err))
+			return
+		}
+	} else {
+		defer hostDir.lockFile(name)()
+		current, err := os.ReadFile(hostDir.filePath(name))
+		etag := ""
+		if err == nil {
+			etag = hostDir.entityTag(name, current)
+		} else if !os.IsNotExist(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !opts.condition.satisfied(etag) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error()})
+			return
+		}
+		if current != nil {
+			change := reservationChange{Name: name, Operation: opts.operation, Identity: opts.identity, Previous: current}
+			if err := hostDir.commit(change); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
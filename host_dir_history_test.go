@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryStoreRecord(t *testing.T) {
+	hs := newHistoryStore(t.TempDir() + "/hosts/")
+	assert.Equal(t, "hosts.history", hs.path[strings.LastIndex(hs.path, "/")+1:])
+
+	// The content written outside the API is recorded before the change
+	assert.NoError(t, hs.record(reservationChange{
+		Name: "00:1a:2b:3c:4d:5e", Operation: "update", Identity: "token:01234567",
+		Previous: []byte("00:1a:2b:3c:4d:5e,192.168.1.100\n"), Content: []byte("00:1a:2b:3c:4d:5e,192.168.1.101\n"),
+	}))
+	assert.NoError(t, hs.record(reservationChange{
+		Name: "00:1a:2b:3c:4d:5e", Operation: "delete",
+		Previous: []byte("00:1a:2b:3c:4d:5e,192.168.1.101\n"),
+	}))
+
+	entries, err := hs.entries("00:1a:2b:3c:4d:5e")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "external", entries[0].Operation)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,192.168.1.100\n", entries[0].Content)
+	assert.Equal(t, 2, entries[1].Version)
+	assert.Equal(t, "token:01234567", entries[1].Identity)
+	assert.Equal(t, "delete", entries[2].Operation)
+	assert.True(t, entries[2].Deleted)
+}
+
+func TestReservationHistoryAndRestore(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	for _, request := range []struct{ method, url, body string }{
+		{"POST", "/reservations", `{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "hostname": "host1"}`},
+		{"PUT", "/reservations/00:1A:2B:3C:4D:5E", `{"ipv4": "192.168.1.101"}`},
+		{"DELETE", "/reservations/00:1A:2B:3C:4D:5E", ""},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(request.method, request.url, strings.NewReader(request.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Less(t, w.Code, 300, request.method)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations/00:1A:2B:3C:4D:5E/history", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var entries []historyEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "create", entries[0].Operation)
+	assert.Equal(t, "update", entries[1].Operation)
+	assert.Equal(t, "delete", entries[2].Operation)
+
+	// Undo the DELETE by restoring the first version
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/reservations/00:1A:2B:3C:4D:5E/restore?version=1", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	content, _ := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:5e")
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,192.168.1.100,host1\n", string(content))
+
+	entries, _ = newHistoryStore("./test_hosts").entries("00:1a:2b:3c:4d:5e")
+	assert.Equal(t, "restore", entries[len(entries)-1].Operation)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/reservations/00:1A:2B:3C:4D:5E/restore?version=9", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReservationHistoryRecordsToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	os.Mkdir("./test_hosts", 0755)
+	defer removeTestHostDir()
+	ttc := NewTokenChecker(1, 0, 0)
+	// The router of main.go, where the token is required by every route
+	r := newRouter(ttc, nil, "", "./test_hosts")
+
+	body := `{"mac": "00:1a:2b:3c:4d:5e", "ipv4": "192.168.1.100"}`
+	assert.Equal(t, http.StatusUnauthorized, sendTestRequest(r, "POST", "/reservations", "", body).Code)
+	assert.Equal(t, http.StatusCreated, sendTestRequest(r, "POST", "/reservations", ttc.Get(), body).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendTestRequest(r, "GET", "/reservations/00:1a:2b:3c:4d:5e/history", "", "").Code)
+
+	w := sendTestRequest(r, "GET", "/reservations/00:1a:2b:3c:4d:5e/history", ttc.Get(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entries []historyEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, tokenIdentity(ttc.Get()), entries[0].Identity)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// conflictError reports an IPv4 address or hostname that is already reserved for another MAC.
+type conflictError struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	MAC   string `json:"mac"`
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("%s %s is reserved by %s", e.Field, e.Value, e.MAC)
+}
+
+// reservationIndex maps the IPv4 addresses and hostnames in the host directory to the MAC that reserves them.
+type reservationIndex struct {
+	mac      map[string]reservation
+	ipv4     map[string]string
+	hostname map[string]string
+}
+
+// newReservationIndex indexes the reservations by their normalized MAC, IPv4 address and hostname.
+func newReservationIndex(reservations []reservation) *reservationIndex {
+	idx := &reservationIndex{
+		mac:      make(map[string]reservation),
+		ipv4:     make(map[string]string),
+		hostname: make(map[string]string),
+	}
+	for _, res := range reservations {
+		if mac, err := validateMAC(res.MAC); err == nil {
+			idx.set(mac.ToNormalizedString(), res)
+		}
+	}
+	return idx
+}
+
+// ipv4Key returns the normalized form of the address or the address itself when it is invalid.
+func ipv4Key(ipv4 string) string {
+	if addr, err := validateIPv4(ipv4); err == nil {
+		return addr.String()
+	}
+	return ipv4
+}
+
+// hostnameKey returns the hostname in lower case because DNS names are not case sensitive.
+func hostnameKey(hostname string) string {
+	return strings.ToLower(hostname)
+}
+
+// set replaces the entries for the MAC with those of the reservation.
+func (idx *reservationIndex) set(mac string, res reservation) {
+	idx.remove(mac)
+	idx.mac[mac] = res
+	if res.IPv4 != "" {
+		idx.ipv4[ipv4Key(res.IPv4)] = mac
+	}
+	if res.Hostname != "" {
+		idx.hostname[hostnameKey(res.Hostname)] = mac
+	}
+}
+
+// remove deletes the entries for the MAC.
+// An IPv4 address or hostname that another MAC reserves too, e.g., in a file written by hand, is given to that MAC.
+func (idx *reservationIndex) remove(mac string) {
+	if res, exists := idx.mac[mac]; exists {
+		delete(idx.mac, mac)
+		ipv4, hostname := idx.ipv4[ipv4Key(res.IPv4)] == mac, idx.hostname[hostnameKey(res.Hostname)] == mac
+		if ipv4 {
+			delete(idx.ipv4, ipv4Key(res.IPv4))
+		}
+		if hostname {
+			delete(idx.hostname, hostnameKey(res.Hostname))
+		}
+		for other, otherRes := range idx.mac {
+			if ipv4 && res.IPv4 != "" && ipv4Key(otherRes.IPv4) == ipv4Key(res.IPv4) {
+				idx.ipv4[ipv4Key(res.IPv4)] = other
+			}
+			if hostname && res.Hostname != "" && hostnameKey(otherRes.Hostname) == hostnameKey(res.Hostname) {
+				idx.hostname[hostnameKey(res.Hostname)] = other
+			}
+		}
+	}
+}
+
+// conflict returns a *conflictError when another MAC reserves the IPv4 address or hostname of the reservation.
+func (idx *reservationIndex) conflict(mac string, res reservation) error {
+	if other, exists := idx.ipv4[ipv4Key(res.IPv4)]; exists && res.IPv4 != "" && other != mac {
+		return &conflictError{Field: "ipv4", Value: res.IPv4, MAC: other}
+	}
+	if other, exists := idx.hostname[hostnameKey(res.Hostname)]; exists && res.Hostname != "" && other != mac {
+		return &conflictError{Field: "hostname", Value: res.Hostname, MAC: other}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lintProblem describes a file in the host directory that is not a well-formed reservation.
+type lintProblem struct {
+	File     string `json:"file"`
+	Reason   string `json:"reason"` // bad name, parse error, mac mismatch, duplicate ipv4, duplicate hostname or directory
+	Detail   string `json:"detail,omitempty"`
+	Repaired string `json:"repaired,omitempty"` // the name the file was renamed to
+}
+
+// ignoredByDnsmasq reports whether Dnsmasq skips the file when it reads the host directory.
+func ignoredByDnsmasq(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") ||
+		len(name) > 1 && strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#")
+}
+
+// lintFile returns the reservation in the file, the name it should have and the problem with it, if any.
+func lintFile(hostDir *hostDirectory, name string) (reservation, string, *lintProblem) {
+	content, err := os.ReadFile(hostDir.filePath(name))
+	if err != nil {
+		return reservation{}, "", &lintProblem{File: name, Reason: "parse error", Detail: err.Error()}
+	}
+	res, err := parseDhcpHost(string(content))
+	if err != nil {
+		return res, "", &lintProblem{File: name, Reason: "parse error", Detail: err.Error()}
+	}
+	contentMAC, err := validateMAC(res.MAC)
+	if err != nil || res.MAC == "" {
+		return res, "", &lintProblem{File: name, Reason: "parse error", Detail: fmt.Sprintf("invalid MAC address '%s'", res.MAC)}
+	}
+	normalized := contentMAC.ToNormalizedString()
+	if mac, err := validateMAC(name); err != nil {
+		return res, normalized, &lintProblem{File: name, Reason: "bad name", Detail: "the name is not a MAC address"}
+	} else if mac.ToNormalizedString() != normalized {
+		return res, "", &lintProblem{File: name, Reason: "mac mismatch", Detail: fmt.Sprintf("the content is for %s", normalized)}
+	} else if name != normalized {
+		return res, normalized, &lintProblem{File: name, Reason: "bad name", Detail: fmt.Sprintf("the name is not normalized to %s", normalized)}
+	}
+	return res, normalized, nil
+}
+
+// lintHostDirectory returns the problems with the files in the host directory, sorted by file name.
+// With repair, it renames the files with bad names to the normalized MAC in their content when no file has it.
+// The caller must hold the directory lock, exclusively to repair.
+func lintHostDirectory(hostDir *hostDirectory, repair bool, identity string) ([]lintProblem, error) {
+	entries, err := os.ReadDir(hostDir.path)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []lintProblem{}
+	ipv4 := make(map[string][]string)
+	hostname := make(map[string][]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if ignoredByDnsmasq(name) {
+			continue
+		}
+		if entry.IsDir() {
+			problems = append(problems, lintProblem{File: name, Reason: "directory", Detail: "Dnsmasq does not read subdirectories"})
+			continue
+		}
+		res, normalized, problem := lintFile(hostDir, name)
+		if problem != nil && problem.Reason == "bad name" && repair {
+			if _, err := os.Stat(hostDir.filePath(normalized)); err == nil {
+				problem.Detail += fmt.Sprintf("; not renamed because %s exists", normalized)
+			} else if err := renameReservationFile(hostDir, name, normalized, identity); err != nil {
+				problem.Detail += fmt.Sprintf("; not renamed: %v", err)
+			} else {
+				problem.Repaired = normalized
+				name = normalized
+			}
+		}
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+		if normalized != "" {
+			if res.IPv4 != "" {
+				ipv4[ipv4Key(res.IPv4)] = append(ipv4[ipv4Key(res.IPv4)], name)
+			}
+			if res.Hostname != "" {
+				hostname[hostnameKey(res.Hostname)] = append(hostname[hostnameKey(res.Hostname)], name)
+			}
+		}
+	}
+	problems = append(problems, duplicateProblems("duplicate ipv4", ipv4)...)
+	problems = append(problems, duplicateProblems("duplicate hostname", hostname)...)
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].File < problems[j].File })
+	return problems, nil
+}
+
+// duplicateProblems reports each file holding a value that other files hold too.
+func duplicateProblems(reason string, files map[string][]string) []lintProblem {
+	var problems []lintProblem
+	for value, names := range files {
+		if len(names) < 2 {
+			continue
+		}
+		for _, name := range names {
+			problems = append(problems, lintProblem{
+				File: name, Reason: reason, Detail: fmt.Sprintf("%s is in %s", value, strings.Join(names, ", ")),
+			})
+		}
+	}
+	return problems
+}
+
+// renameReservationFile renames the file to the normalized MAC and records it as a new version of that reservation.
+func renameReservationFile(hostDir *hostDirectory, name, normalized, identity string) error {
+	defer hostDir.lockFile(normalized)()
+
+	content, err := os.ReadFile(hostDir.filePath(name))
+	if err != nil {
+		return err
+	}
+	recorded, err := hostDir.history.size(normalized)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(hostDir.filePath(name), hostDir.filePath(normalized)); err != nil {
+		return err
+	}
+	change := reservationChange{Name: normalized, Operation: "repair", Identity: identity, Content: content}
+	if err = hostDir.sync(); err == nil {
+		if err = hostDir.history.record(change); err == nil {
+			err = hostDir.version([]reservationChange{change}, name)
+		}
+	}
+	if err != nil {
+		// Put the file back under its name so the repair is not made without its record
+		hostDir.history.truncate(normalized, recorded)
+		os.Rename(hostDir.filePath(normalized), hostDir.filePath(name))
+	}
+	return err
+}
+
+// lintReservations reports the problem files in the host directory; with POST, it also repairs their names.
+func lintReservations(c *gin.Context, hostDir *hostDirectory, repair bool) {
+	if repair {
+		hostDir.mu.Lock()
+		defer hostDir.mu.Unlock()
+	} else {
+		hostDir.mu.RLock()
+		defer hostDir.mu.RUnlock()
+	}
+
+	if problems, err := lintHostDirectory(hostDir, repair, requestIdentity(c)); err == nil {
+		c.JSON(http.StatusOK, problems)
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
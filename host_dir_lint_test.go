@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLintTestFiles() {
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e", []byte("00:1a:2b:3c:4d:5e,192.168.1.100,host1\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5f", []byte("00:1a:2b:3c:4d:5f,192.168.1.100,host2\n"), 0644)
+	os.WriteFile("./test_hosts/00-1A-2B-3C-4D-60", []byte("00:1a:2b:3c:4d:60,192.168.1.102\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:61", []byte("00:1a:2b:3c:4d:62,192.168.1.103\n"), 0644)
+	os.WriteFile("./test_hosts/printer", []byte("00:1a:2b:3c:4d:63,192.168.1.104,HOST1\n"), 0644)
+	os.WriteFile("./test_hosts/notes.txt", []byte("not a reservation\n"), 0644)
+	os.WriteFile("./test_hosts/.00:1a:2b:3c:4d:5e.123", []byte("ignored\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e~", []byte("ignored\n"), 0644)
+	os.Mkdir("./test_hosts/old", 0755)
+	os.WriteFile("./test_hosts/old/00:1a:2b:3c:4d:64", []byte("00:1a:2b:3c:4d:64,192.168.1.105\n"), 0644)
+}
+
+func TestLintReservations(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+	writeLintTestFiles()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations/lint", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var problems []lintProblem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problems))
+	reasons := make(map[string][]string)
+	for _, problem := range problems {
+		reasons[problem.File] = append(reasons[problem.File], problem.Reason)
+		assert.Empty(t, problem.Repaired)
+	}
+	assert.Equal(t, map[string][]string{
+		"00-1A-2B-3C-4D-60": {"bad name"},
+		"00:1a:2b:3c:4d:5e": {"duplicate ipv4", "duplicate hostname"},
+		"00:1a:2b:3c:4d:5f": {"duplicate ipv4"},
+		"00:1a:2b:3c:4d:61": {"mac mismatch"},
+		"notes.txt":         {"parse error"},
+		"old":               {"directory"},
+		"printer":           {"bad name", "duplicate hostname"},
+	}, reasons)
+
+	// The list does not descend into the subdirectory or read the files with bad names
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations", nil)
+	r.ServeHTTP(w, req)
+	var reservations []reservation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reservations))
+	assert.Len(t, reservations, 3)
+}
+
+func TestLintReservationsRepair(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+	writeLintTestFiles()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/lint", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var problems []lintProblem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problems))
+	repaired := make(map[string]string)
+	for _, problem := range problems {
+		if problem.Repaired != "" {
+			repaired[problem.File] = problem.Repaired
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"00-1A-2B-3C-4D-60": "00:1a:2b:3c:4d:60",
+		"printer":           "00:1a:2b:3c:4d:63",
+	}, repaired)
+
+	content, err := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:60")
+	assert.NoError(t, err)
+	assert.Equal(t, "00:1a:2b:3c:4d:60,192.168.1.102\n", string(content))
+	_, err = os.Stat("./test_hosts/printer")
+	assert.True(t, os.IsNotExist(err))
+
+	// The renamed files are reported by their new names from then on
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/lint", nil)
+	r.ServeHTTP(w, req)
+	assert.NotContains(t, w.Body.String(), "bad name")
+	assert.Contains(t, w.Body.String(), `"file":"00:1a:2b:3c:4d:63","reason":"duplicate hostname"`)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// reservationMetadata holds what a dhcp-host entry cannot, which is kept in a sidecar file per reservation.
+type reservationMetadata struct {
+	Description string     `json:"description,omitempty"`
+	Owner       string     `json:"owner,omitempty"`
+	AssetID     string     `json:"asset_id,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"` // when the reservation was created through the API
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // when the reservation is expired
+	OnExpiry    string     `json:"on_expiry,omitempty"`  // delete (the default) or ignore
+}
+
+func (m reservationMetadata) empty() bool {
+	return m == reservationMetadata{}
+}
+
+// metadataStore keeps the metadata of each reservation in a JSON file named by its MAC.
+// The files are only changed through the store, which keeps them in memory, reading them again
+// when the directory is replaced.
+type metadataStore struct {
+	path    string
+	mu      sync.Mutex
+	loaded  os.FileInfo // the directory that was read, or nil
+	entries map[string]reservationMetadata
+}
+
+// newMetadataStore returns the metadata store for the host directory, i.e., the directory named host-dir.meta.
+func newMetadataStore(hostDirPath string) *metadataStore {
+	return &metadataStore{path: filepath.Clean(hostDirPath) + ".meta", entries: map[string]reservationMetadata{}}
+}
+
+// load reads every file unless the directory was already read; the caller must hold ms.mu.
+func (ms *metadataStore) load() error {
+	info, err := os.Stat(ms.path)
+	if os.IsNotExist(err) {
+		ms.loaded, ms.entries = nil, map[string]reservationMetadata{}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if ms.loaded != nil && os.SameFile(info, ms.loaded) {
+		return nil
+	}
+
+	files, err := os.ReadDir(ms.path)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]reservationMetadata, len(files))
+	for _, file := range files {
+		if file.IsDir() || ignoredByDnsmasq(file.Name()) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(ms.path, file.Name()))
+		if err != nil {
+			return err
+		}
+		var meta reservationMetadata
+		if err := json.Unmarshal(content, &meta); err == nil {
+			entries[file.Name()] = meta
+		}
+	}
+	ms.loaded, ms.entries = info, entries
+	return nil
+}
+
+// get returns the metadata of the named reservation.
+func (ms *metadataStore) get(name string) (reservationMetadata, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.load(); err != nil {
+		return reservationMetadata{}, err
+	}
+	return ms.entries[name], nil
+}
+
+// attach sets the metadata of each reservation, which are named by their normalized MAC.
+func (ms *metadataStore) attach(reservations []reservation) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.load(); err != nil {
+		return err
+	}
+	for i := range reservations {
+		if mac, err := validateMAC(reservations[i].MAC); err == nil {
+			reservations[i].reservationMetadata = ms.entries[mac.ToNormalizedString()]
+		}
+	}
+	return nil
+}
+
+// set replaces the metadata of the named reservation, removing its file when the metadata is empty.
+// The creation time is kept from the metadata it replaces unless the new metadata has one.
+func (ms *metadataStore) set(name string, meta reservationMetadata) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.load(); err != nil {
+		return err
+	}
+	if meta.CreatedAt == nil {
+		meta.CreatedAt = ms.entries[name].CreatedAt
+	}
+	if meta.empty() {
+		return ms.remove(name)
+	}
+
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ms.path, 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(ms.path, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(ms.path, name)); err != nil {
+		return err
+	}
+	if ms.loaded == nil {
+		ms.loaded, _ = os.Stat(ms.path)
+	}
+	ms.entries[name] = meta
+	return nil
+}
+
+// remove deletes the metadata of the named reservation; the caller must hold ms.mu.
+func (ms *metadataStore) remove(name string) error {
+	if _, exists := ms.entries[name]; !exists {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(ms.path, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(ms.entries, name)
+	return nil
+}
+
+// delete removes the metadata of the named reservation.
+func (ms *metadataStore) delete(name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.load(); err != nil {
+		return err
+	}
+	return ms.remove(name)
+}
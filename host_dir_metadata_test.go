@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservationMetadata(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "description": "Lobby printer", "owner": "facilities", "asset_id": "A-1001"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// The metadata is kept beside the host directory, not in it
+	content, _ := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:5e")
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,192.168.1.100\n", string(content))
+	assert.FileExists(t, "./test_hosts.meta/00:1a:2b:3c:4d:5e")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/00:1a:2b:3c:4d:5e", nil)
+	r.ServeHTTP(w, req)
+	var res reservation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "Lobby printer", res.Description)
+	assert.Equal(t, "facilities", res.Owner)
+	assert.Equal(t, "A-1001", res.AssetID)
+	assert.NotNil(t, res.CreatedAt)
+	createdAt := *res.CreatedAt
+
+	// A PATCH keeps the rest of the metadata and the creation time
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/reservations/00:1a:2b:3c:4d:5e", strings.NewReader(`{"owner": "it", "hostname": "printer"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	reservations := listTestReservations(t, "/reservations?owner=IT&description=lobby*")
+	assert.Len(t, reservations, 1)
+	assert.Equal(t, "Lobby printer", reservations[0].Description)
+	assert.Equal(t, "printer", reservations[0].Hostname)
+	assert.True(t, createdAt.Equal(*reservations[0].CreatedAt))
+	assert.Empty(t, listTestReservations(t, "/reservations?asset_id=A-1002"))
+
+	// Deleting the reservation deletes its metadata
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/reservations/00:1a:2b:3c:4d:5e", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoFileExists(t, "./test_hosts.meta/00:1a:2b:3c:4d:5e")
+}
+
+func TestReservationMetadataTooLong(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "owner": "`+strings.Repeat("x", maxMetadataLength+1)+`"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"owner"`)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errPreconditionFailed = errors.New("precondition failed")
+
+// entityTag returns the strong entity tag (ETag) for the content of a reservation file.
+func entityTag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// precondition holds the If-Match and If-None-Match request headers.
+type precondition struct {
+	ifMatch     string
+	ifNoneMatch string
+}
+
+func requestPrecondition(c *gin.Context) precondition {
+	return precondition{ifMatch: c.GetHeader("If-Match"), ifNoneMatch: c.GetHeader("If-None-Match")}
+}
+
+// matchesEntityTag reports whether the header, a list of entity tags or "*", matches the entity tag.
+// Weak entity tags (W/) only match when weak is true. An empty entity tag means the file does not exist,
+// which nothing matches.
+func matchesEntityTag(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag || weak && strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfied reports whether a change to the file with the entity tag may proceed (RFC 9110).
+func (p precondition) satisfied(etag string) bool {
+	if p.ifMatch != "" && !matchesEntityTag(p.ifMatch, etag, false) {
+		return false
+	}
+	if p.ifNoneMatch != "" && matchesEntityTag(p.ifNoneMatch, etag, true) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreconditionSatisfied(t *testing.T) {
+	etag := entityTag([]byte("00:1a:2b:3c:4d:5e,192.168.1.100\n"))
+
+	assert.True(t, precondition{}.satisfied(etag))
+	assert.True(t, precondition{}.satisfied(""))
+	assert.True(t, precondition{ifMatch: etag}.satisfied(etag))
+	assert.True(t, precondition{ifMatch: `"other", ` + etag}.satisfied(etag))
+	assert.True(t, precondition{ifMatch: "*"}.satisfied(etag))
+	assert.False(t, precondition{ifMatch: "*"}.satisfied(""))
+	assert.False(t, precondition{ifMatch: "W/" + etag}.satisfied(etag))
+	assert.False(t, precondition{ifMatch: `"other"`}.satisfied(etag))
+	assert.True(t, precondition{ifNoneMatch: "*"}.satisfied(""))
+	assert.False(t, precondition{ifNoneMatch: "*"}.satisfied(etag))
+	assert.False(t, precondition{ifNoneMatch: "W/" + etag}.satisfied(etag))
+}
+
+func TestReservationETag(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	// If-None-Match: * only creates a reservation that does not exist
+	for _, status := range []int{http.StatusCreated, http.StatusPreconditionFailed} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"ipv4": "192.168.1.100"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-None-Match", "*")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations/00:1A:2B:3C:4D:5E", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/00:1A:2B:3C:4D:5E", nil)
+	req.Header.Set("If-None-Match", etag)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// The first change with the ETag succeeds, the second, with the stale ETag, fails
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"ipv4": "192.168.1.101"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", etag)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"hostname": "host1"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", etag)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/reservations/00:1A:2B:3C:4D:5E", nil)
+	req.Header.Set("If-Match", etag)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.FileExists(t, "./test_hosts/00:1a:2b:3c:4d:5e")
+
+	content, _ := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:5e")
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,192.168.1.101\n", string(content))
+
+	// The ETag covers the metadata too, so it comes from the server
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/00:1A:2B:3C:4D:5E", nil)
+	r.ServeHTTP(w, req)
+	assert.NotEqual(t, entityTag(content), w.Header().Get("ETag"))
+
+	etag = w.Header().Get("ETag")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/reservations/00:1A:2B:3C:4D:5E", nil)
+	req.Header.Set("If-Match", etag)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
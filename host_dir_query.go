@@ -0,0 +1,227 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net/netip"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seancfoley/ipaddress-go/ipaddr"
+)
+
+// reservationQuery filters and sorts the list of reservations by the query parameters of GET /reservations.
+type reservationQuery struct {
+	ipv4           string
+	hostname       string            // a glob matched case-insensitively
+	tags           []string          // every one of them
+	network        *ipaddr.IPAddress // from cidr or range
+	leaseTime      string
+	owner          string
+	assetID        string
+	description    string // a glob matched case-insensitively
+	expiringBefore *time.Time
+	sortBy         string
+	descending     bool
+}
+
+// reservationSortKeys are the values of the sort query parameter.
+var reservationSortKeys = []string{"mac", "ipv4", "hostname", "lease_time", "expires_at"}
+
+// newReservationQuery returns the query in the request parameters.
+func newReservationQuery(c *gin.Context) (reservationQuery, error) {
+	q := reservationQuery{
+		ipv4:        c.Query("ipv4"),
+		hostname:    strings.ToLower(c.Query("hostname")),
+		tags:        c.QueryArray("tag"),
+		leaseTime:   c.Query("lease_time"),
+		owner:       c.Query("owner"),
+		assetID:     c.Query("asset_id"),
+		description: strings.ToLower(c.Query("description")),
+		sortBy:      c.DefaultQuery("sort", "mac"),
+	}
+	if _, err := path.Match(q.hostname, ""); err != nil {
+		return q, fmt.Errorf("invalid hostname pattern")
+	}
+	if _, err := path.Match(q.description, ""); err != nil {
+		return q, fmt.Errorf("invalid description pattern")
+	}
+	if c.Query("cidr") != "" && c.Query("range") != "" {
+		return q, fmt.Errorf("only one of cidr and range is allowed")
+	}
+	if expression := c.Query("cidr") + c.Query("range"); expression != "" {
+		network, err := ipaddr.NewIPAddressString(expression).ToAddress()
+		if err != nil {
+			return q, fmt.Errorf("invalid cidr or range: %v", err)
+		}
+		q.network = network
+	}
+	if q.leaseTime != "" && !isLeaseTime(q.leaseTime) {
+		return q, fmt.Errorf("invalid lease time")
+	}
+	if before := c.Query("expiring_before"); before != "" {
+		expiringBefore, err := parseExpiringBefore(before, time.Now())
+		if err != nil {
+			return q, err
+		}
+		q.expiringBefore = &expiringBefore
+	}
+	if !slices.Contains(reservationSortKeys, q.sortBy) {
+		return q, fmt.Errorf("sort must be one of %s", strings.Join(reservationSortKeys, ", "))
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		q.descending = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+	return q, nil
+}
+
+// parseExpiringBefore returns the time in the expiring_before parameter, an RFC 3339 time or a duration from now.
+func parseExpiringBefore(value string, now time.Time) (time.Time, error) {
+	if before, err := time.Parse(time.RFC3339, value); err == nil {
+		return before, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiring_before: it must be an RFC 3339 time or a duration, e.g., 24h")
+}
+
+// literalHostname reports whether the hostname pattern has no wildcards, so it can be looked up.
+func (q reservationQuery) literalHostname() bool {
+	return q.hostname != "" && !strings.ContainsAny(q.hostname, `*?[\`)
+}
+
+// match reports whether the reservation passes every filter of the query.
+func (q reservationQuery) match(res reservation) bool {
+	if q.ipv4 != "" && ipv4Key(res.IPv4) != ipv4Key(q.ipv4) {
+		return false
+	}
+	if q.hostname != "" {
+		if matched, _ := path.Match(q.hostname, strings.ToLower(res.Hostname)); !matched {
+			return false
+		}
+	}
+	for _, tag := range q.tags {
+		if !slices.Contains(res.Tags, tag) {
+			return false
+		}
+	}
+	if q.network != nil {
+		if addr, err := validateIPv4(res.IPv4); err != nil || res.IPv4 == "" || !q.network.Contains(addr) {
+			return false
+		}
+	}
+	if q.leaseTime != "" && (res.LeaseTime == "" || leaseTimeOrder(res.LeaseTime) != leaseTimeOrder(q.leaseTime)) {
+		return false
+	}
+	if q.owner != "" && !strings.EqualFold(res.Owner, q.owner) {
+		return false
+	}
+	if q.assetID != "" && res.AssetID != q.assetID {
+		return false
+	}
+	if q.expiringBefore != nil && (res.ExpiresAt == nil || !res.ExpiresAt.Before(*q.expiringBefore)) {
+		return false
+	}
+	if q.description != "" {
+		if matched, _ := path.Match(q.description, strings.ToLower(res.Description)); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// leaseTimeOrder returns the seconds in the lease time: -1 when there is none and the most there can be when infinite.
+func leaseTimeOrder(leaseTime string) int {
+	if leaseTime == "" {
+		return -1
+	}
+	if seconds, finite := leaseTimeSeconds(leaseTime); finite {
+		return seconds
+	}
+	return math.MaxInt
+}
+
+// ipv4Order returns the address to sort by; reservations without one come first.
+func ipv4Order(ipv4 string) netip.Addr {
+	addr, _ := netip.ParseAddr(ipv4)
+	return addr
+}
+
+// compareExpiresAt compares the expiry times of the reservations; those that never expire come last.
+func compareExpiresAt(a, b reservation) int {
+	switch {
+	case a.ExpiresAt == nil && b.ExpiresAt == nil:
+		return 0
+	case a.ExpiresAt == nil:
+		return 1
+	case b.ExpiresAt == nil:
+		return -1
+	}
+	return a.ExpiresAt.Compare(*b.ExpiresAt)
+}
+
+// sort orders the reservations, which are ordered by MAC, by the sort and order parameters.
+func (q reservationQuery) sort(reservations []reservation) {
+	compare := map[string]func(a, b reservation) int{
+		"mac":      func(a, b reservation) int { return strings.Compare(a.MAC, b.MAC) },
+		"ipv4":     func(a, b reservation) int { return ipv4Order(a.IPv4).Compare(ipv4Order(b.IPv4)) },
+		"hostname": func(a, b reservation) int { return strings.Compare(hostnameKey(a.Hostname), hostnameKey(b.Hostname)) },
+		"lease_time": func(a, b reservation) int {
+			return cmp.Compare(leaseTimeOrder(a.LeaseTime), leaseTimeOrder(b.LeaseTime))
+		},
+		"expires_at": compareExpiresAt,
+	}[q.sortBy]
+	sort.SliceStable(reservations, func(i, j int) bool {
+		if q.descending {
+			return compare(reservations[j], reservations[i]) < 0
+		}
+		return compare(reservations[i], reservations[j]) < 0
+	})
+}
+
+// queryReservations returns the reservations in hostDir that match the query in its order.
+// An IPv4 address or a hostname without wildcards is looked up in the index rather than matched against every one.
+func queryReservations(hostDir *hostDirectory, q reservationQuery) ([]reservation, error) {
+	hostDir.mu.RLock()
+	defer hostDir.mu.RUnlock()
+
+	reservations := []reservation{}
+	var metadataErr error
+	err := hostDir.withIndex(func(idx *reservationIndex) {
+		var candidates []reservation
+		if q.ipv4 != "" || q.literalHostname() {
+			mac, found := idx.ipv4[ipv4Key(q.ipv4)]
+			if q.ipv4 == "" {
+				mac, found = idx.hostname[q.hostname]
+			}
+			if found {
+				candidates = []reservation{idx.mac[mac]}
+			}
+		} else {
+			candidates = idx.sortedReservations()
+		}
+		if err := hostDir.metadata.attach(candidates); err != nil {
+			metadataErr = err
+		}
+		for _, res := range candidates {
+			if q.match(res) {
+				reservations = append(reservations, res)
+			}
+		}
+	})
+	if err == nil {
+		err = metadataErr
+	}
+	q.sort(reservations)
+	return reservations, err
+}
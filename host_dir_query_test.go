@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeQueryTestFiles() {
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e", []byte("00:1a:2b:3c:4d:5e,set:iot,set:safe,192.168.1.100,lamp,1h\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5f", []byte("00:1a:2b:3c:4d:5f,set:iot,192.168.1.20,Laptop,60m\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:60", []byte("00:1a:2b:3c:4d:60,set:safe,10.0.0.5,printer,infinite\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:61", []byte("00:1a:2b:3c:4d:61,192.168.2.1\n"), 0644)
+}
+
+func queryTestMACs(t *testing.T, url string) []string {
+	var macs []string
+	for _, res := range listTestReservations(t, url) {
+		macs = append(macs, res.MAC)
+	}
+	return macs
+}
+
+func TestQueryReservations(t *testing.T) {
+	defer removeTestHostDir()
+	setupRouterForReservationsTests()
+	writeQueryTestFiles()
+
+	for url, expected := range map[string][]string{
+		"/reservations?tag=iot":                            {"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f"},
+		"/reservations?tag=iot&tag=safe":                   {"00:1a:2b:3c:4d:5e"},
+		"/reservations?cidr=192.168.1.0/24":                {"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f"},
+		"/reservations?range=192.168.1-2.1-50":             {"00:1a:2b:3c:4d:5f", "00:1a:2b:3c:4d:61"},
+		"/reservations?hostname=l*":                        {"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f"},
+		"/reservations?hostname=LAPTOP":                    {"00:1a:2b:3c:4d:5f"},
+		"/reservations?lease_time=3600":                    {"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f"},
+		"/reservations?lease_time=infinite":                {"00:1a:2b:3c:4d:60"},
+		"/reservations?sort=ipv4":                          {"00:1a:2b:3c:4d:60", "00:1a:2b:3c:4d:5f", "00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:61"},
+		"/reservations?sort=hostname&order=desc":           {"00:1a:2b:3c:4d:60", "00:1a:2b:3c:4d:5f", "00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:61"},
+		"/reservations?sort=lease_time&order=desc&tag=iot": {"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f"},
+		"/reservations?order=desc":                         {"00:1a:2b:3c:4d:61", "00:1a:2b:3c:4d:60", "00:1a:2b:3c:4d:5f", "00:1a:2b:3c:4d:5e"},
+	} {
+		assert.Equal(t, expected, queryTestMACs(t, url), url)
+	}
+}
+
+func TestQueryReservationsInvalid(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	for _, url := range []string{
+		"/reservations?cidr=invalid",
+		"/reservations?cidr=192.168.1.0/24&range=192.168.1.1-5",
+		"/reservations?hostname=[",
+		"/reservations?lease_time=soon",
+		"/reservations?sort=tags",
+		"/reservations?order=up",
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+}
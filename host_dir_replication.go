@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	replicationPush = "push"
+	replicationPull = "pull"
+	// replicationPath is where a peer serves and takes the state of its reservation files.
+	replicationPath = "/replication/files"
+)
+
+// replicaFile is the state of a reservation file that is exchanged with a peer.
+// A deleted file is one whose last version in the history is a deletion.
+type replicaFile struct {
+	Name       string               `json:"name"`
+	Content    string               `json:"content,omitempty"`
+	Deleted    bool                 `json:"deleted,omitempty"`
+	ModifiedAt time.Time            `json:"modified_at"`
+	Metadata   *reservationMetadata `json:"metadata,omitempty"`
+}
+
+// replicationResult reports what applying the files of a peer did.
+type replicationResult struct {
+	Applied  []string          `json:"applied"`
+	Kept     []string          `json:"kept"` // changed here later than at the peer, so kept
+	Rejected []snapshotProblem `json:"rejected"`
+	Newer    []replicaFile     `json:"newer"` // changed here later than at the peer, or only here, for the peer to apply
+}
+
+// add adds what applying files on the other side did.
+func (r *replicationResult) add(other replicationResult) {
+	r.Applied = append(r.Applied, other.Applied...)
+	r.Kept = append(r.Kept, other.Kept...)
+	r.Rejected = append(r.Rejected, other.Rejected...)
+}
+
+// replicationStatus reports the state of the replication with a peer.
+type replicationStatus struct {
+	Mode        string     `json:"mode"` // push, pull or off
+	Peer        string     `json:"peer,omitempty"`
+	Interval    string     `json:"interval,omitempty"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Applied     int        `json:"applied"`  // the files changed by every replication so far
+	Kept        int        `json:"kept"`     // the conflicts resolved in favor of the newer file
+	Rejected    int        `json:"rejected"` // the invalid files that were not applied
+}
+
+// replicator pushes the reservation files to, or pulls them from, a peer.
+type replicator struct {
+	hostDir  *hostDirectory
+	peer     string
+	mode     string
+	token    string // sent in the Authorization header when it is set
+	interval time.Duration
+	client   *http.Client
+	mu       sync.Mutex
+	status   replicationStatus
+}
+
+// newReplicator returns a replicator of hostDir with the peer, which is the base URL of another dnsmasq-web.
+func newReplicator(hostDir *hostDirectory, peer, mode, token string, interval time.Duration) (*replicator, error) {
+	if mode != replicationPush && mode != replicationPull {
+		return nil, fmt.Errorf("the replication mode must be push or pull")
+	}
+	if u, err := url.Parse(peer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid peer URL '%s'", peer)
+	}
+	return &replicator{
+		hostDir: hostDir, peer: strings.TrimSuffix(peer, "/"), mode: mode, token: token, interval: interval,
+		client: &http.Client{Timeout: 30 * time.Second},
+		status: replicationStatus{Mode: mode, Peer: peer, Interval: interval.String()},
+	}, nil
+}
+
+// replicaFiles returns the state of every reservation file in hostDir, deleted ones included, ordered by name.
+// The caller must hold the directory lock.
+func replicaFiles(hostDir *hostDirectory) ([]replicaFile, error) {
+	current, err := readSnapshotFiles(hostDir)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := hostDir.history.deletions()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []replicaFile{}
+	for name, entry := range current {
+		info, err := os.Stat(hostDir.filePath(name))
+		if err != nil {
+			return nil, err
+		}
+		file := replicaFile{Name: name, Content: string(entry.content), ModifiedAt: info.ModTime().UTC()}
+		if !entry.metadata.empty() {
+			file.Metadata = &entry.metadata
+		}
+		files = append(files, file)
+	}
+	for name, when := range deleted {
+		if _, exists := current[name]; !exists {
+			files = append(files, replicaFile{Name: name, Deleted: true, ModifiedAt: when.UTC()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// checkReplicaFile returns an error unless the file is named by a normalized MAC and has a valid reservation.
+func checkReplicaFile(file replicaFile) error {
+	if mac, err := validateMAC(file.Name); err != nil || mac.ToNormalizedString() != file.Name {
+		return fmt.Errorf("not named by a normalized MAC address")
+	}
+	if file.Deleted {
+		return nil
+	}
+	res, err := parseDhcpHost(file.Content)
+	if err != nil {
+		return err
+	}
+	if name, _, err := formatReservation(res); err != nil {
+		return err
+	} else if name != file.Name {
+		return fmt.Errorf("the file of %s must be named %s", res.MAC, name)
+	}
+	return nil
+}
+
+// applyReplicaFiles changes each reservation file in hostDir that differs from the file of the peer
+// unless it was changed here later, i.e., the newer file wins. A file whose IPv4 address or hostname another
+// MAC reserves is rejected like one that is invalid. The result has the files that are newer here, or only here,
+// for the peer to apply in turn.
+// A written file keeps the modification time of the peer so the two are the same afterwards.
+func applyReplicaFiles(hostDir *hostDirectory, files []replicaFile, identity string) (replicationResult, error) {
+	result := replicationResult{Applied: []string{}, Kept: []string{}, Rejected: []snapshotProblem{}, Newer: []replicaFile{}}
+
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	local, err := replicaFiles(hostDir)
+	if err != nil {
+		return result, err
+	}
+	current := make(map[string]replicaFile, len(local))
+	for _, file := range local {
+		current[file.Name] = file
+	}
+
+	var apply []replicaFile
+	sent := make(map[string]bool, len(files))
+	for _, file := range files {
+		sent[file.Name] = true
+		if err := checkReplicaFile(file); err != nil {
+			result.Rejected = append(result.Rejected, snapshotProblem{File: file.Name, Error: err.Error()})
+			continue
+		}
+		here, exists := current[file.Name]
+		metadata := reservationMetadata{}
+		if file.Metadata != nil {
+			metadata = *file.Metadata
+		}
+		hereMetadata := reservationMetadata{}
+		if here.Metadata != nil {
+			hereMetadata = *here.Metadata
+		}
+		if (!exists || here.Deleted) && file.Deleted {
+			continue
+		}
+		if exists && here.Deleted == file.Deleted && here.Content == file.Content && sameMetadata(hereMetadata, metadata) {
+			continue
+		}
+		if exists && !here.ModifiedAt.Before(file.ModifiedAt) {
+			result.Kept = append(result.Kept, file.Name)
+			result.Newer = append(result.Newer, here)
+			continue
+		}
+		apply = append(apply, file)
+	}
+	for _, file := range local {
+		if !sent[file.Name] && !file.Deleted {
+			result.Newer = append(result.Newer, file)
+		}
+	}
+	apply, conflicts, err := withoutReplicaConflicts(hostDir, apply)
+	if err != nil {
+		return result, err
+	}
+	result.Rejected = append(result.Rejected, conflicts...)
+
+	var changes []reservationChange
+	var undos []func()
+	for _, file := range apply {
+		change := reservationChange{Name: file.Name, Operation: "replicate", Identity: identity}
+		if here, exists := current[file.Name]; exists && !here.Deleted {
+			change.Previous = []byte(here.Content)
+		}
+		if !file.Deleted {
+			change.Content, change.Metadata = []byte(file.Content), &reservationMetadata{}
+			if file.Metadata != nil {
+				change.Metadata = file.Metadata
+			}
+		}
+		undo, err := hostDir.stage(change)
+		if err == nil && !file.Deleted {
+			if err = os.Chtimes(hostDir.filePath(file.Name), file.ModifiedAt, file.ModifiedAt); err != nil {
+				undo()
+			}
+		}
+		if err != nil {
+			undoAll(undos)
+			return replicationResult{}, fmt.Errorf("%s: %v", file.Name, err)
+		}
+		changes, undos = append(changes, change), append(undos, undo)
+		result.Applied = append(result.Applied, file.Name)
+	}
+	if err := hostDir.version(changes); err != nil {
+		undoAll(undos)
+		return replicationResult{}, err
+	}
+	return result, nil
+}
+
+// withoutReplicaConflicts returns the files without those whose IPv4 address or hostname another MAC reserves,
+// either in a file the others leave in place or in another of the files, and the conflicts of those.
+// Leaving a file out changes the reservations that stay, so the rest are checked again without it.
+func withoutReplicaConflicts(hostDir *hostDirectory, files []replicaFile) ([]replicaFile, []snapshotProblem, error) {
+	existing, err := readReservations(hostDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	conflicts := []snapshotProblem{}
+	for {
+		index := newReservationIndex(existing)
+		for _, file := range files {
+			index.remove(file.Name)
+		}
+		conflicting := -1
+		for i, file := range files {
+			if file.Deleted {
+				continue
+			}
+			res, _ := parseDhcpHost(file.Content) // valid because it was checked
+			if err := index.conflict(file.Name, res); err != nil {
+				conflicts = append(conflicts, snapshotProblem{File: file.Name, Error: err.Error()})
+				conflicting = i
+				break
+			}
+			index.set(file.Name, res)
+		}
+		if conflicting < 0 {
+			return files, conflicts, nil
+		}
+		files = slices.Delete(slices.Clone(files), conflicting, conflicting+1)
+	}
+}
+
+// request sends a request to the peer with the token and decodes the JSON response into v.
+func (rp *replicator) request(method string, body any, v any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, rp.peer+replicationPath, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", gin.MIMEJSON)
+	if rp.token != "" {
+		req.Header.Set(tokenHeader, rp.token)
+	}
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("%s %s: %s %s", method, rp.peer+replicationPath, resp.Status, failure.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// sync pushes the state of every reservation file to the peer or pulls the state of the peer's and applies it.
+// Either way, the files that are newer on the side that applied the others are then applied on the other side.
+func (rp *replicator) sync() error {
+	var result replicationResult
+	var err error
+	if rp.mode == replicationPull {
+		var files []replicaFile
+		if err = rp.request(http.MethodGet, nil, &files); err == nil {
+			result, err = applyReplicaFiles(rp.hostDir, files, "peer:"+rp.peer)
+		}
+		if err == nil && len(result.Newer) > 0 {
+			var pushed replicationResult
+			err = rp.request(http.MethodPost, result.Newer, &pushed)
+			result.add(pushed)
+		}
+	} else {
+		rp.hostDir.mu.RLock()
+		files, filesErr := replicaFiles(rp.hostDir)
+		rp.hostDir.mu.RUnlock()
+		if err = filesErr; err == nil {
+			err = rp.request(http.MethodPost, files, &result)
+		}
+		if err == nil && len(result.Newer) > 0 {
+			var pulled replicationResult
+			pulled, err = applyReplicaFiles(rp.hostDir, result.Newer, "peer:"+rp.peer)
+			result.add(pulled)
+		}
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	now := time.Now().UTC()
+	rp.status.LastAttempt = &now
+	rp.status.Applied += len(result.Applied)
+	rp.status.Kept += len(result.Kept)
+	rp.status.Rejected += len(result.Rejected)
+	if err != nil {
+		rp.status.LastError = err.Error()
+	} else {
+		rp.status.LastSuccess, rp.status.LastError = &now, ""
+	}
+	return err
+}
+
+// replicationStatus returns a copy of the status.
+func (rp *replicator) replicationStatus() replicationStatus {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	return rp.status
+}
+
+// ReplicateHostDir pushes the reservation files in the host directory to the peer, or pulls them from it,
+// every interval until the process exits. The newer of two different files wins.
+// The token, when it is not empty, is one the peer issued.
+func ReplicateHostDir(hostDirPath, peer, mode, token string, interval time.Duration) error {
+	hostDir := openHostDirectory(hostDirPath)
+	rp, err := newReplicator(hostDir, peer, mode, token, interval)
+	if err != nil {
+		return err
+	}
+	hostDir.replication = rp
+	go func() {
+		for {
+			if err := rp.sync(); err != nil {
+				fmt.Fprintf(os.Stderr, "unable to %s reservations: %v\n", mode, err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+	return nil
+}
+
+// getReplicaFiles responds with the state of every reservation file.
+func getReplicaFiles(c *gin.Context, hostDir *hostDirectory) {
+	hostDir.mu.RLock()
+	defer hostDir.mu.RUnlock()
+
+	files, err := replicaFiles(hostDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, files)
+}
+
+// postReplicaFiles applies the state of the reservation files of a peer and responds with what it did.
+func postReplicaFiles(c *gin.Context, hostDir *hostDirectory) {
+	var files []replicaFile
+	if err := c.ShouldBindJSON(&files); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := applyReplicaFiles(hostDir, files, requestIdentity(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// getReplicationStatus responds with the status of the replication with a peer.
+func getReplicationStatus(c *gin.Context, hostDir *hostDirectory) {
+	if hostDir.replication == nil {
+		c.JSON(http.StatusOK, replicationStatus{Mode: "off"})
+		return
+	}
+	c.JSON(http.StatusOK, hostDir.replication.replicationStatus())
+}
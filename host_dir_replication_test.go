@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func removeTestPeerHostDir() {
+	openHostDirectory("./test_hosts_peer").replication = nil
+	os.RemoveAll("./test_hosts_peer")
+	os.RemoveAll("./test_hosts_peer.history")
+	os.RemoveAll("./test_hosts_peer.meta")
+}
+
+func sendTestRequest(r *gin.Engine, method, url, token, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tokenHeader, token)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestReplication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer removeTestHostDir()
+	defer removeTestPeerHostDir()
+
+	// The primary requires a token as main.go does and is served; the standby replicates with it
+	os.Mkdir("./test_hosts", 0755)
+	ttc := NewTokenChecker(1, 0, 0)
+	token := ttc.Get()
+	primary := newRouter(ttc, nil, "", "./test_hosts")
+	server := httptest.NewServer(primary)
+	defer server.Close()
+	os.Mkdir("./test_hosts_peer", 0755)
+	standby := DhcpHostDir(gin.New(), "./test_hosts_peer")
+	standbyDir := openHostDirectory("./test_hosts_peer")
+
+	assert.Equal(t, http.StatusUnauthorized, sendTestRequest(primary, "GET", replicationPath, "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, sendTestRequest(primary, "POST", replicationPath, "", "[]").Code)
+
+	for _, body := range []string{
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "owner": "facilities"}`,
+		`{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.101"}`,
+	} {
+		assert.Equal(t, http.StatusCreated, sendTestRequest(primary, "POST", "/reservations", token, body).Code)
+	}
+
+	puller, err := newReplicator(standbyDir, server.URL, replicationPull, token, time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, puller.sync())
+	assert.Equal(t, 2, puller.replicationStatus().Applied)
+	for _, name := range []string{"00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5f"} {
+		content, _ := os.ReadFile("./test_hosts/" + name)
+		replica, _ := os.ReadFile("./test_hosts_peer/" + name)
+		assert.Equal(t, string(content), string(replica))
+		info, _ := os.Stat("./test_hosts/" + name)
+		replicaInfo, _ := os.Stat("./test_hosts_peer/" + name)
+		assert.True(t, info.ModTime().Equal(replicaInfo.ModTime()))
+	}
+	w := sendTestRequest(standby, "GET", "/reservations/00:1a:2b:3c:4d:5e", "", "")
+	assert.Contains(t, w.Body.String(), `"owner":"facilities"`)
+
+	// A deletion at the primary is replicated, a later change at the standby is kept and sent back
+	assert.Equal(t, http.StatusOK, sendTestRequest(primary, "DELETE", "/reservations/00:1a:2b:3c:4d:5e", token, "").Code)
+	assert.Equal(t, http.StatusCreated, sendTestRequest(standby, "PUT", "/reservations/00:1a:2b:3c:4d:5f", "", `{"ipv4": "192.168.1.111"}`).Code)
+	assert.NoError(t, puller.sync())
+	assert.NoFileExists(t, "./test_hosts_peer/00:1a:2b:3c:4d:5e")
+	for _, path := range []string{"./test_hosts/00:1a:2b:3c:4d:5f", "./test_hosts_peer/00:1a:2b:3c:4d:5f"} {
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "00:1a:2b:3c:4d:5f,192.168.1.111\n", string(content), path)
+	}
+	status := puller.replicationStatus()
+	assert.Equal(t, 4, status.Applied)
+	assert.Equal(t, 1, status.Kept)
+	assert.Empty(t, status.LastError)
+
+	var history []historyEntry
+	json.Unmarshal(sendTestRequest(primary, "GET", "/reservations/00:1a:2b:3c:4d:5f/history", token, "").Body.Bytes(), &history)
+	assert.Equal(t, "replicate", history[len(history)-1].Operation)
+
+	// Pushing sends the reservations only at the standby and applies those only at the primary
+	assert.Equal(t, http.StatusCreated, sendTestRequest(standby, "POST", "/reservations", "", `{"mac": "00:1a:2b:3c:4d:60", "ipv4": "192.168.1.120"}`).Code)
+	assert.Equal(t, http.StatusCreated, sendTestRequest(primary, "POST", "/reservations", token, `{"mac": "00:1a:2b:3c:4d:61", "ipv4": "192.168.1.121"}`).Code)
+	pusher, err := newReplicator(standbyDir, server.URL, replicationPush, token, time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, pusher.sync())
+	assert.Equal(t, 2, pusher.replicationStatus().Applied)
+	assert.FileExists(t, "./test_hosts/00:1a:2b:3c:4d:60")
+	assert.FileExists(t, "./test_hosts_peer/00:1a:2b:3c:4d:61")
+
+	// Reservations of the same address by different MACs are rejected on both sides
+	assert.Equal(t, http.StatusCreated, sendTestRequest(primary, "POST", "/reservations", token, `{"mac": "00:1a:2b:3c:4d:62", "ipv4": "192.168.1.130"}`).Code)
+	assert.Equal(t, http.StatusCreated, sendTestRequest(standby, "POST", "/reservations", "", `{"mac": "00:1a:2b:3c:4d:63", "ipv4": "192.168.1.130"}`).Code)
+	assert.NoError(t, puller.sync())
+	assert.Equal(t, 2, puller.replicationStatus().Rejected)
+	assert.NoFileExists(t, "./test_hosts/00:1a:2b:3c:4d:63")
+	assert.NoFileExists(t, "./test_hosts_peer/00:1a:2b:3c:4d:62")
+
+	// A peer that refuses the token
+	refused, _ := newReplicator(standbyDir, server.URL, replicationPull, "wrong", time.Minute)
+	assert.Error(t, refused.sync())
+	standbyDir.replication = refused
+	var replication replicationStatus
+	json.Unmarshal(sendTestRequest(standby, "GET", "/replication/status", "", "").Body.Bytes(), &replication)
+	assert.Equal(t, replicationPull, replication.Mode)
+	assert.Equal(t, server.URL, replication.Peer)
+	assert.Nil(t, replication.LastSuccess)
+	assert.Contains(t, replication.LastError, "401")
+}
+
+func TestReplicationRejectsInvalidFiles(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := sendTestRequest(r, "POST", replicationPath, "", `[
+		{"name": "00-1a-2b-3c-4d-5e", "content": "00:1a:2b:3c:4d:5e,192.168.1.100\n", "modified_at": "2024-07-04T12:00:00Z"},
+		{"name": "00:1a:2b:3c:4d:5f", "content": "00:1a:2b:3c:4d:5f,192.168.1.100,foo_bar\n", "modified_at": "2024-07-04T12:00:00Z"},
+		{"name": "00:1a:2b:3c:4d:60", "content": "00:1a:2b:3c:4d:60,192.168.1.102\n", "modified_at": "2024-07-04T12:00:00Z"}
+	]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result replicationResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []string{"00:1a:2b:3c:4d:60"}, result.Applied)
+	assert.Len(t, result.Rejected, 2)
+
+	// The address of another MAC is rejected unless the same files give that MAC another one
+	w = sendTestRequest(r, "POST", replicationPath, "", `[
+		{"name": "00:1a:2b:3c:4d:61", "content": "00:1a:2b:3c:4d:61,192.168.1.102\n", "modified_at": "2024-07-04T12:00:00Z"}
+	]`)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Empty(t, result.Applied)
+	assert.Equal(t, "00:1a:2b:3c:4d:61", result.Rejected[0].File)
+	assert.Contains(t, result.Rejected[0].Error, "00:1a:2b:3c:4d:60")
+	assert.Equal(t, "00:1a:2b:3c:4d:60", result.Newer[0].Name) // only here
+
+	w = sendTestRequest(r, "POST", replicationPath, "", `[
+		{"name": "00:1a:2b:3c:4d:61", "content": "00:1a:2b:3c:4d:61,192.168.1.102\n", "modified_at": "2024-07-04T12:00:00Z"},
+		{"name": "00:1a:2b:3c:4d:60", "content": "00:1a:2b:3c:4d:60,192.168.1.103\n", "modified_at": "2030-07-04T12:00:00Z"}
+	]`)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []string{"00:1a:2b:3c:4d:61", "00:1a:2b:3c:4d:60"}, result.Applied)
+	assert.Empty(t, result.Rejected)
+
+	var replication replicationStatus
+	json.Unmarshal(sendTestRequest(r, "GET", "/replication/status", "", "").Body.Bytes(), &replication)
+	assert.Equal(t, "off", replication.Mode)
+
+	_, err := newReplicator(openHostDirectory("./test_hosts"), "standby:867", replicationPull, "", time.Minute)
+	assert.Error(t, err)
+	_, err = newReplicator(openHostDirectory("./test_hosts"), "http://standby:867", "both", "", time.Minute)
+	assert.Error(t, err)
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	snapshotMerge   = "merge"
+	snapshotReplace = "replace"
+	// snapshotManifestName is the name of the manifest in the archive; the files are under snapshotDirectory.
+	snapshotManifestName = "manifest.json"
+	snapshotDirectory    = "hosts"
+	// maxSnapshotSize and maxSnapshotFileSize limit what a restore reads.
+	maxSnapshotSize     = 64 << 20
+	maxSnapshotFileSize = 64 << 10
+)
+
+// snapshotManifest lists every reservation file in a snapshot.
+type snapshotManifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []snapshotFile `json:"files"`
+}
+
+// snapshotFile is one reservation file in a snapshot with its checksum and metadata.
+type snapshotFile struct {
+	Name     string               `json:"name"`
+	SHA256   string               `json:"sha256"`
+	Metadata *reservationMetadata `json:"metadata,omitempty"`
+}
+
+// snapshotEntry is a reservation file read from a snapshot.
+type snapshotEntry struct {
+	name     string
+	content  []byte
+	res      reservation
+	metadata reservationMetadata
+}
+
+// snapshotProblem is why a file in a snapshot cannot be restored.
+type snapshotProblem struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// snapshotDiff reports the reservations a restore adds, changes and removes.
+type snapshotDiff struct {
+	Mode      string   `json:"mode"`
+	DryRun    bool     `json:"dry_run,omitempty"`
+	Added     []string `json:"added"`
+	Changed   []string `json:"changed"`
+	Removed   []string `json:"removed"`
+	Unchanged int      `json:"unchanged"`
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// sameMetadata reports whether the metadata are equal, comparing the times they point to rather than the pointers.
+func sameMetadata(a, b reservationMetadata) bool {
+	encodedA, _ := json.Marshal(a)
+	encodedB, _ := json.Marshal(b)
+	return bytes.Equal(encodedA, encodedB)
+}
+
+// readSnapshotFiles reads every reservation file in hostDir with its metadata; the caller must hold the directory lock.
+func readSnapshotFiles(hostDir *hostDirectory) (map[string]snapshotEntry, error) {
+	var names []string
+	if err := hostDir.withIndex(func(idx *reservationIndex) { names = idx.sortedNames() }); err != nil {
+		return nil, err
+	}
+	files := make(map[string]snapshotEntry, len(names))
+	for _, name := range names {
+		content, err := os.ReadFile(hostDir.filePath(name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		metadata, err := hostDir.metadata.get(name)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = snapshotEntry{name: name, content: content, metadata: metadata}
+	}
+	return files, nil
+}
+
+// getSnapshot responds with a tar.gz of every reservation file and a manifest of them.
+// The files are read into memory under the directory lock, which is released before the archive is written
+// so a slow client does not hold up the changes.
+func getSnapshot(c *gin.Context, hostDir *hostDirectory) {
+	hostDir.mu.RLock()
+	files, err := readSnapshotFiles(hostDir)
+	hostDir.mu.RUnlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	manifest := snapshotManifest{Version: 1, CreatedAt: now, Files: []snapshotFile{}}
+	for _, file := range files {
+		entry := snapshotFile{Name: file.name, SHA256: checksum(file.content)}
+		if !file.metadata.empty() {
+			entry.Metadata = &file.metadata
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Name < manifest.Files[j].Name })
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="reservations-%s.tar.gz"`, now.Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+	compressed := gzip.NewWriter(c.Writer)
+	archive := tar.NewWriter(compressed)
+	write := func(name string, content []byte) error {
+		header := &tar.Header{Name: name, Mode: 0640, Size: int64(len(content)), ModTime: now, Typeflag: tar.TypeReg}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := archive.Write(content)
+		return err
+	}
+	if err := write(snapshotManifestName, encoded); err != nil {
+		return
+	}
+	for _, file := range manifest.Files {
+		if err := write(path.Join(snapshotDirectory, file.Name), files[file.Name].content); err != nil {
+			return
+		}
+	}
+	if archive.Close() == nil {
+		compressed.Close()
+	}
+}
+
+// readSnapshot reads the files in a snapshot and checks each against the manifest.
+// It returns an error when the archive cannot be read and the problems with the files it has.
+func readSnapshot(body io.Reader) ([]snapshotEntry, []snapshotProblem, error) {
+	compressed, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	archive := tar.NewReader(compressed)
+
+	var manifest *snapshotManifest
+	contents := make(map[string][]byte)
+	problems := []snapshotProblem{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot: %v", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		// The manifest has an entry for every reservation, so it is limited like the whole snapshot
+		limit := maxSnapshotFileSize
+		if header.Name == snapshotManifestName {
+			limit = maxSnapshotSize
+		}
+		content, err := io.ReadAll(io.LimitReader(archive, int64(limit)+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot: %v", err)
+		}
+		dir, name := path.Split(path.Clean(header.Name))
+		switch {
+		case header.Typeflag != tar.TypeReg:
+			problems = append(problems, snapshotProblem{File: header.Name, Error: "not a regular file"})
+		case len(content) > limit:
+			problems = append(problems, snapshotProblem{File: header.Name, Error: "too large"})
+		case header.Name == snapshotManifestName:
+			manifest = &snapshotManifest{}
+			if err := json.Unmarshal(content, manifest); err != nil {
+				return nil, nil, fmt.Errorf("invalid snapshot manifest: %v", err)
+			}
+		case dir == snapshotDirectory+"/":
+			contents[name] = content
+		default:
+			problems = append(problems, snapshotProblem{File: header.Name, Error: "not in the hosts directory"})
+		}
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("invalid snapshot: there is no %s", snapshotManifestName)
+	}
+	if manifest.Version != 1 {
+		return nil, nil, fmt.Errorf("invalid snapshot: manifest version %d is not supported", manifest.Version)
+	}
+
+	var entries []snapshotEntry
+	listed := make(map[string]bool)
+	for _, file := range manifest.Files {
+		reject := func(message string) {
+			problems = append(problems, snapshotProblem{File: file.Name, Error: message})
+		}
+		if listed[file.Name] {
+			reject("listed more than once")
+			continue
+		}
+		listed[file.Name] = true
+		content, exists := contents[file.Name]
+		if !exists {
+			reject("missing from the archive")
+			continue
+		}
+		if checksum(content) != file.SHA256 {
+			reject("checksum does not match the manifest")
+			continue
+		}
+		entry := snapshotEntry{name: file.Name, content: content}
+		if file.Metadata != nil {
+			entry.metadata = *file.Metadata
+		}
+		entry.res, err = parseDhcpHost(string(content))
+		if err != nil {
+			reject(err.Error())
+			continue
+		}
+		entry.res.reservationMetadata = entry.metadata
+		if name, _, err := formatReservation(entry.res); err != nil {
+			reject(err.Error())
+			continue
+		} else if name != file.Name {
+			reject(fmt.Sprintf("the file of %s must be named %s", entry.res.MAC, name))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	for name := range contents {
+		if !listed[name] {
+			problems = append(problems, snapshotProblem{File: path.Join(snapshotDirectory, name), Error: "not in the manifest"})
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].File < problems[j].File })
+	return entries, problems, nil
+}
+
+// restoreSnapshot validates the snapshot in the request body and restores it, responding with what it changed.
+// With mode=replace, the reservations that are not in the snapshot are removed;
+// with mode=merge, the default, they are kept and checked for conflicts with those in the snapshot.
+// Nothing is changed when any file is invalid or, with dry_run=true, at all.
+func restoreSnapshot(c *gin.Context, hostDir *hostDirectory) {
+	diff := snapshotDiff{
+		Mode: c.DefaultQuery("mode", snapshotMerge), DryRun: c.Query("dry_run") == "true",
+		Added: []string{}, Changed: []string{}, Removed: []string{},
+	}
+	if diff.Mode != snapshotMerge && diff.Mode != snapshotReplace {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be merge or replace"})
+		return
+	}
+	entries, problems, err := readSnapshot(http.MaxBytesReader(c.Writer, c.Request.Body, maxSnapshotSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid snapshot", "problems": problems})
+		return
+	}
+
+	// Hold the directory lock exclusively so the restore is not interleaved with other changes
+	hostDir.mu.Lock()
+	defer hostDir.mu.Unlock()
+
+	current, err := readSnapshotFiles(hostDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	restored := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		restored[entry.name] = true
+	}
+	idx := newReservationIndex(nil)
+	if diff.Mode == snapshotMerge {
+		for name, file := range current {
+			if !restored[name] {
+				if res, err := parseDhcpHost(string(file.content)); err == nil {
+					idx.set(name, res)
+				}
+			}
+		}
+	}
+	for _, entry := range entries {
+		if err := idx.conflict(entry.name, entry.res); err != nil && c.Query("force") != "true" {
+			problems = append(problems, snapshotProblem{File: entry.name, Error: err.Error()})
+		}
+		idx.set(entry.name, entry.res)
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "the snapshot conflicts with the reservations it keeps", "problems": problems})
+		return
+	}
+
+	identity := requestIdentity(c)
+	var changes []reservationChange
+	for _, entry := range entries {
+		file, exists := current[entry.name]
+		if exists && bytes.Equal(file.content, entry.content) && sameMetadata(file.metadata, entry.metadata) {
+			diff.Unchanged++
+			continue
+		}
+		if exists {
+			diff.Changed = append(diff.Changed, entry.name)
+		} else {
+			diff.Added = append(diff.Added, entry.name)
+		}
+		metadata := entry.metadata
+		changes = append(changes, reservationChange{
+			Name: entry.name, Operation: "snapshot", Identity: identity, Previous: file.content, Content: entry.content,
+			Metadata: &metadata,
+		})
+	}
+	if diff.Mode == snapshotReplace {
+		for name, file := range current {
+			if !restored[name] {
+				diff.Removed = append(diff.Removed, name)
+				changes = append(changes, reservationChange{Name: name, Operation: "snapshot", Identity: identity, Previous: file.content})
+			}
+		}
+		sort.Strings(diff.Removed)
+	}
+	if diff.DryRun {
+		c.JSON(http.StatusOK, diff)
+		return
+	}
+
+	// Put back the files already written when one fails so the restore is all or nothing
+	if err := hostDir.commitAll(changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// readTestSnapshot returns the files in a snapshot archive by name.
+func readTestSnapshot(t *testing.T, body []byte) map[string][]byte {
+	compressed, err := gzip.NewReader(bytes.NewReader(body))
+	assert.NoError(t, err)
+	archive := tar.NewReader(compressed)
+	files := make(map[string][]byte)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		files[header.Name], _ = io.ReadAll(archive)
+	}
+	return files
+}
+
+// writeTestSnapshot returns a snapshot archive of the files, which are written in order.
+func writeTestSnapshot(files ...[2]string) []byte {
+	var body bytes.Buffer
+	compressed := gzip.NewWriter(&body)
+	archive := tar.NewWriter(compressed)
+	for _, file := range files {
+		archive.WriteHeader(&tar.Header{Name: file[0], Mode: 0640, Size: int64(len(file[1])), Typeflag: tar.TypeReg})
+		archive.Write([]byte(file[1]))
+	}
+	archive.Close()
+	compressed.Close()
+	return body.Bytes()
+}
+
+func postTestSnapshot(r *gin.Engine, query string, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/snapshot"+query, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/gzip")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSnapshot(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	for _, body := range []string{
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "owner": "facilities"}`,
+		`{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.101"}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations/snapshot", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	snapshot := w.Body.Bytes()
+
+	files := readTestSnapshot(t, snapshot)
+	assert.Len(t, files, 3)
+	assert.Equal(t, "00:1a:2b:3c:4d:5f,192.168.1.101\n", string(files["hosts/00:1a:2b:3c:4d:5f"]))
+	var manifest snapshotManifest
+	assert.NoError(t, json.Unmarshal(files[snapshotManifestName], &manifest))
+	assert.Len(t, manifest.Files, 2)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", manifest.Files[0].Name)
+	assert.Equal(t, "facilities", manifest.Files[0].Metadata.Owner)
+	assert.Equal(t, checksum(files["hosts/00:1a:2b:3c:4d:5f"]), manifest.Files[1].SHA256)
+
+	// Delete one, change another and add a third
+	os.Remove("./test_hosts/00:1a:2b:3c:4d:5e")
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5f", []byte("00:1a:2b:3c:4d:5f,192.168.1.111\n"), 0644)
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:60", []byte("00:1a:2b:3c:4d:60,192.168.1.102\n"), 0644)
+
+	w = postTestSnapshot(r, "?dry_run=true", snapshot)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var diff snapshotDiff
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, snapshotDiff{
+		Mode: snapshotMerge, DryRun: true,
+		Added: []string{"00:1a:2b:3c:4d:5e"}, Changed: []string{"00:1a:2b:3c:4d:5f"}, Removed: []string{},
+	}, diff)
+	assert.NoFileExists(t, "./test_hosts/00:1a:2b:3c:4d:5e")
+
+	w = postTestSnapshot(r, "?mode=replace", snapshot)
+	assert.Equal(t, http.StatusOK, w.Code)
+	diff = snapshotDiff{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, snapshotDiff{
+		Mode:  snapshotReplace,
+		Added: []string{"00:1a:2b:3c:4d:5e"}, Changed: []string{"00:1a:2b:3c:4d:5f"}, Removed: []string{"00:1a:2b:3c:4d:60"},
+	}, diff)
+	content, _ := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:5f")
+	assert.Equal(t, "00:1a:2b:3c:4d:5f,192.168.1.101\n", string(content))
+	assert.NoFileExists(t, "./test_hosts/00:1a:2b:3c:4d:60")
+	reservations := listTestReservations(t, "/reservations?owner=facilities")
+	assert.Len(t, reservations, 1)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", reservations[0].MAC)
+
+	// Restoring it again changes nothing
+	w = postTestSnapshot(r, "", snapshot)
+	diff = snapshotDiff{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, 2, diff.Unchanged)
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Changed)
+}
+
+func TestSnapshotRestoreRejected(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:60", []byte("00:1a:2b:3c:4d:60,192.168.1.100\n"), 0644)
+	content := "00:1a:2b:3c:4d:5e,192.168.1.100\n"
+	manifest := `{"version": 1, "files": [{"name": "00:1a:2b:3c:4d:5e", "sha256": "` + checksum([]byte(content)) + `"}]}`
+
+	// The kept reservation reserves the same address
+	w := postTestSnapshot(r, "", writeTestSnapshot([2]string{"manifest.json", manifest}, [2]string{"hosts/00:1a:2b:3c:4d:5e", content}))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NoFileExists(t, "./test_hosts/00:1a:2b:3c:4d:5e")
+	w = postTestSnapshot(r, "?mode=replace", writeTestSnapshot([2]string{"manifest.json", manifest}, [2]string{"hosts/00:1a:2b:3c:4d:5e", content}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = postTestSnapshot(r, "", writeTestSnapshot(
+		[2]string{"manifest.json", manifest},
+		[2]string{"hosts/00:1a:2b:3c:4d:5e", "00:1a:2b:3c:4d:5e,192.168.1.101\n"},
+		[2]string{"hosts/00:1a:2b:3c:4d:5f", "00:1a:2b:3c:4d:5f,192.168.1.102\n"},
+	))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "checksum does not match the manifest")
+	assert.Contains(t, w.Body.String(), "not in the manifest")
+
+	w = postTestSnapshot(r, "", writeTestSnapshot([2]string{"hosts/00:1a:2b:3c:4d:5e", content}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postTestSnapshot(r, "", []byte("not gzip"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postTestSnapshot(r, "?mode=overwrite", writeTestSnapshot([2]string{"manifest.json", manifest}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSnapshotRoundTripLargeManifest(t *testing.T) {
+	defer removeTestHostDir()
+
+	// Enough reservations that the manifest is larger than a reservation file may be,
+	// written before the router so they are loaded at once rather than as changes
+	os.Mkdir("./test_hosts", 0755)
+	for i := 0; i < 1000; i++ {
+		mac := fmt.Sprintf("00:1a:2b:3c:%02x:%02x", i/256, i%256)
+		os.WriteFile("./test_hosts/"+mac, []byte(fmt.Sprintf("%s,10.0.%d.%d\n", mac, i/256, i%256)), 0644)
+	}
+	r := setupRouterForReservationsTests()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/reservations/snapshot", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	snapshot := w.Body.Bytes()
+	assert.Greater(t, len(readTestSnapshot(t, snapshot)[snapshotManifestName]), maxSnapshotFileSize)
+
+	w = postTestSnapshot(r, "?dry_run=true", snapshot)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var diff snapshotDiff
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, 1000, diff.Unchanged)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tagCount is a tag with the number of reservations that set it and that match it.
+type tagCount struct {
+	Tag     string `json:"tag"`
+	Count   int    `json:"count"`             // the reservations that set the tag, i.e., its members
+	Matches int    `json:"matches,omitempty"` // the reservations that only apply to clients with (or without) the tag
+}
+
+// countTags returns every tag the reservations set or match, ordered by name.
+func countTags(reservations []reservation) []tagCount {
+	counts := make(map[string]*tagCount)
+	count := func(tag string) *tagCount {
+		if counts[tag] == nil {
+			counts[tag] = &tagCount{Tag: tag}
+		}
+		return counts[tag]
+	}
+	for _, res := range reservations {
+		for _, tag := range res.Tags {
+			count(tag).Count++
+		}
+		for _, tag := range res.MatchTags {
+			count(strings.TrimPrefix(tag, "!")).Matches++
+		}
+	}
+
+	tags := make([]tagCount, 0, len(counts))
+	for _, tag := range counts {
+		tags = append(tags, *tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags
+}
+
+func listTags(c *gin.Context, hostDir *hostDirectory) {
+	if reservations, err := listReservations(hostDir); err == nil {
+		writeList(c, countTags(reservations), []string{"tag", "count", "matches"}, func(tag tagCount) []string {
+			return []string{tag.Tag, strconv.Itoa(tag.Count), strconv.Itoa(tag.Matches)}
+		})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func listTagMembers(c *gin.Context, hostDir *hostDirectory) {
+	tag := c.Param("tag")
+	if err := validateTag(tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if reservations, err := queryReservations(hostDir, reservationQuery{tags: []string{tag}, sortBy: "mac"}); err == nil {
+		writeList(c, reservations, reservationCSVHeader, reservationToCSV)
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// setTagMember adds the tag to the reservation of the mac parameter or, unless add is set, removes it.
+func setTagMember(c *gin.Context, hostDir *hostDirectory, add bool) {
+	tag := c.Param("tag")
+	if err := validateTag(tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	operation := "untag"
+	if add {
+		operation = "tag"
+	}
+	changeReservationFile(c, hostDir, operation, func(current reservation) (reservation, int, error) {
+		member := slices.Contains(current.Tags, tag)
+		if add && !member {
+			current.Tags = append(slices.Clone(current.Tags), tag)
+		} else if !add && member {
+			current.Tags = slices.DeleteFunc(slices.Clone(current.Tags), func(t string) bool { return t == tag })
+		} else if !add {
+			return current, http.StatusNotFound, fmt.Errorf("not a member of %s", tag)
+		}
+		return current, http.StatusOK, nil
+	})
+}
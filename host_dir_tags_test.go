@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTags(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+	writeQueryTestFiles()
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:62", []byte("00:1a:2b:3c:4d:62,tag:!safe,192.168.1.30\n"), 0644)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/tags", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var tags []tagCount
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tags))
+	assert.Equal(t, []tagCount{{Tag: "iot", Count: 2}, {Tag: "safe", Count: 2, Matches: 1}}, tags)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/tags/safe", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var members []reservation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &members))
+	assert.Len(t, members, 2)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", members[0].MAC)
+	assert.Equal(t, "00:1a:2b:3c:4d:60", members[1].MAC)
+}
+
+func TestSetTagMember(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+	writeQueryTestFiles()
+
+	for _, request := range []struct {
+		method, url string
+		code        int
+	}{
+		{"PUT", "/tags/unsafe/members/00:1A:2B:3C:4D:61", http.StatusOK},
+		{"PUT", "/tags/unsafe/members/00:1A:2B:3C:4D:61", http.StatusOK},
+		{"DELETE", "/tags/iot/members/00:1a:2b:3c:4d:5e", http.StatusOK},
+		{"DELETE", "/tags/iot/members/00:1a:2b:3c:4d:5e", http.StatusNotFound},
+		{"PUT", "/tags/unsafe/members/00:1a:2b:3c:4d:99", http.StatusNotFound},
+		{"PUT", "/tags/un,safe/members/00:1a:2b:3c:4d:61", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(request.method, request.url, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, request.code, w.Code, request.method+" "+request.url)
+	}
+
+	content, _ := os.ReadFile("./test_hosts/00:1a:2b:3c:4d:61")
+	assert.Equal(t, "00:1a:2b:3c:4d:61,set:unsafe,192.168.2.1\n", string(content))
+	content, _ = os.ReadFile("./test_hosts/00:1a:2b:3c:4d:5e")
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,set:safe,192.168.1.100,lamp,1h\n", string(content))
+
+	// Adding a tag twice changes the file once
+	entries, _ := newHistoryStore("./test_hosts").entries("00:1a:2b:3c:4d:61")
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "external", entries[0].Operation)
+	assert.Equal(t, "tag", entries[1].Operation)
+}
@@ -21,9 +21,15 @@ func setupRouterForReservationsTests() *gin.Engine {
 	return r
 }
 
+func removeTestHostDir() {
+	os.RemoveAll("./test_hosts")
+	os.RemoveAll("./test_hosts.history")
+	os.RemoveAll("./test_hosts.meta")
+}
+
 func TestCreateReservation(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
@@ -42,7 +48,7 @@ func TestCreateReservation(t *testing.T) {
 
 func TestCreateMinimalReservation(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
@@ -58,7 +64,7 @@ func TestCreateMinimalReservation(t *testing.T) {
 
 func TestCreateReservationWithInvalidIPv4(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
@@ -76,7 +82,7 @@ func TestCreateReservationWithInvalidIPv4(t *testing.T) {
 
 func TestCreateReservationWithMissingMAC(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
@@ -93,7 +99,7 @@ func TestCreateReservationWithMissingMAC(t *testing.T) {
 
 func TestCreateReservationWithInvalidMAC(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
@@ -111,7 +117,7 @@ func TestCreateReservationWithInvalidMAC(t *testing.T) {
 
 func TestUpdateReservation(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	// First create a reservation
 	w := httptest.NewRecorder()
@@ -147,7 +153,7 @@ func TestUpdateReservation(t *testing.T) {
 
 func TestUpdateReservationNoTags(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	// First create a reservation
 	w := httptest.NewRecorder()
@@ -166,7 +172,7 @@ func TestUpdateReservationNoTags(t *testing.T) {
 
 func TestDeleteReservation(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	// First create a reservation
 	w := httptest.NewRecorder()
@@ -193,7 +199,7 @@ func TestDeleteReservation(t *testing.T) {
 
 func TestDeleteNonexistentReservation(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("DELETE", "/reservations/00:1A:2B:3C:4D:5E", nil)
@@ -203,7 +209,7 @@ func TestDeleteNonexistentReservation(t *testing.T) {
 }
 func TestGetAllReservations(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	// Create a few reservations
 	reservations := []string{
@@ -231,7 +237,7 @@ func TestGetAllReservations(t *testing.T) {
 
 func TestGetReservation(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	// Create a reservation
 	w := httptest.NewRecorder()
@@ -260,7 +266,7 @@ func TestGetReservation(t *testing.T) {
 
 func TestGetNonexistentReservation(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/reservations/00:1A:2B:3C:4D:5E", nil)
@@ -271,7 +277,7 @@ func TestGetNonexistentReservation(t *testing.T) {
 
 func TestGetReservationWithInvalidMAC(t *testing.T) {
 	r := setupRouterForReservationsTests()
-	defer os.RemoveAll("./test_hosts")
+	defer removeTestHostDir()
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/reservations/00:1A:2B:3C:4D:5G", nil)
@@ -279,3 +285,284 @@ func TestGetReservationWithInvalidMAC(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestImportReservations(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/import", strings.NewReader(`[
+		{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "tags": ["tag1"], "hostname": "host1"},
+		{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.256"}
+	]`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"imported":1`)
+	assert.Contains(t, w.Body.String(), "invalid IPv4 address")
+	assert.FileExists(t, filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.NoFileExists(t, filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5f"))
+}
+
+func TestImportReservationsAtomic(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/import?atomic=true", strings.NewReader(
+		"{\"mac\": \"00:1A:2B:3C:4D:5E\", \"ipv4\": \"192.168.1.100\"}\n"+
+			"{\"mac\": \"00:1A:2B:3C:4D:5F\"}\n",
+	))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":424`)
+	assert.NoFileExists(t, filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+}
+
+func TestImportReservationsCSV(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/import", strings.NewReader(
+		"mac,ipv4,hostname,tags\n00:1A:2B:3C:4D:5E,192.168.1.100,host1,\"tag1,tag2\"\n",
+	))
+	req.Header.Set("Content-Type", "text/csv")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	content, _ := os.ReadFile(filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,set:tag1,set:tag2,192.168.1.100,host1\n", string(content))
+}
+
+func TestExportReservations(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
+		"mac": "00:1A:2B:3C:4D:5E",
+		"ipv4": "192.168.1.100",
+		"tags": ["tag1", "tag2"],
+		"hostname": "host1"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/export", nil)
+	req.Header.Set("Accept", "text/csv")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "mac,ipv4,hostname,lease_time,tags,macs,client_id,match_tags,ipv6,ignore,description,owner,asset_id,expires_at,on_expiry\n"+
+		"00:1a:2b:3c:4d:5e,192.168.1.100,host1,,\"tag1,tag2\",,,,,,,,,,\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/export?format=ndjson", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "\n"))
+	assert.Contains(t, w.Body.String(), `"mac":"00:1a:2b:3c:4d:5e"`)
+}
+
+func TestCreateReservationWithDuplicateIPv4(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
+		"mac": "00:1A:2B:3C:4D:5E",
+		"ipv4": "192.168.1.100",
+		"hostname": "host1"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/reservations", strings.NewReader(`{
+		"mac": "00:1A:2B:3C:4D:5F",
+		"ipv4": "192.168.1.100",
+		"hostname": "host2"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"mac":"00:1a:2b:3c:4d:5e"`)
+	assert.NoFileExists(t, filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5f"))
+
+	// A hostname conflict is detected regardless of case
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5F", strings.NewReader(`{
+		"ipv4": "192.168.1.101",
+		"hostname": "HOST1"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"hostname"`)
+}
+
+func TestUpdateReservationWithDuplicateIPv4Forced(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	for _, res := range []string{
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100"}`,
+		`{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.101"}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(res))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	// Updating a reservation with its own address is not a conflict
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"ipv4": "192.168.1.100", "hostname": "host1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5E?force=true", strings.NewReader(`{"ipv4": "192.168.1.101"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	content, _ := os.ReadFile(filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,192.168.1.101\n", string(content))
+}
+
+func TestCreateReservationFullGrammar(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
+		"mac": "00:1A:2B:3C:4D:5E",
+		"macs": ["00:1A:2B:3C:4D:5F"],
+		"client_id": "*",
+		"tags": ["trusted"],
+		"match_tags": ["lan"],
+		"ipv4": "192.168.1.100",
+		"ipv6": ["fd00::100"],
+		"hostname": "laptop",
+		"lease_time": "infinite"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	content, _ := os.ReadFile(filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,00:1a:2b:3c:4d:5f,id:*,set:trusted,tag:lan,192.168.1.100,[fd00::100],laptop,infinite\n", string(content))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/reservations/00:1A:2B:3C:4D:5E", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"macs":["00:1a:2b:3c:4d:5f"]`)
+	assert.Contains(t, w.Body.String(), `"ipv6":["fd00::100"]`)
+	assert.Contains(t, w.Body.String(), `"match_tags":["lan"]`)
+}
+
+func TestCreateIgnoreReservation(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{"mac": "00:1A:2B:3C:4D:5E", "ignore": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	content, _ := os.ReadFile(filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,ignore\n", string(content))
+
+	// Without ignore or IPv6 addresses the IPv4 address is required
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"hostname": "host1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPatchReservation(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
+		"mac": "00:1A:2B:3C:4D:5E",
+		"ipv4": "192.168.1.100",
+		"tags": ["unsafe"],
+		"hostname": "host1",
+		"lease_time": "24h"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Change the tags and remove the lease time with a merge patch
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"tags": ["safe"], "lease_time": null}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	content, _ := os.ReadFile(filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,set:safe,192.168.1.100,host1\n", string(content))
+
+	// Add a tag with a JSON Patch
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`[{"op": "add", "path": "/tags/-", "value": "iot"}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	content, _ = os.ReadFile(filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,set:safe,set:iot,192.168.1.100,host1\n", string(content))
+}
+
+func TestPatchReservationErrors(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"hostname": "host2"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/reservations", strings.NewReader(`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	for _, patch := range []string{
+		`{"mac": "00:1a:2b:3c:4d:5f"}`,
+		`{"ipv4": null}`,
+		`{"hostname": "foo,set:trusted"}`,
+		`{"tags": "safe"}`,
+		`not json`,
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("PATCH", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(patch))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, patch)
+	}
+	content, _ := os.ReadFile(filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,192.168.1.100\n", string(content))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// minimumLeaseTime is the shortest lease time in seconds that Dnsmasq uses; it raises shorter ones to it.
+const minimumLeaseTime = 120
+
+// dryRunResult reports what POST /reservations would do with a reservation.
+type dryRunResult struct {
+	MAC      string          `json:"mac,omitempty"`
+	Valid    bool            `json:"valid"`
+	Status   int             `json:"status"`         // the status POST would respond with
+	Line     string          `json:"line,omitempty"` // the dhcp-host entry POST would write
+	Warnings []string        `json:"warnings,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Conflict *conflictError  `json:"conflict,omitempty"`
+	Fields   validationError `json:"fields,omitempty"`
+}
+
+// leaseTimeSeconds returns the number of seconds in a valid lease time and false when it is infinite.
+func leaseTimeSeconds(leaseTime string) (int, bool) {
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	leaseTime = strings.ToLower(leaseTime)
+	multiplier := 1
+	if unit, ok := units[leaseTime[len(leaseTime)-1]]; ok {
+		multiplier = unit
+		leaseTime = leaseTime[:len(leaseTime)-1]
+	}
+	seconds, err := strconv.Atoi(leaseTime)
+	if err != nil {
+		return 0, false
+	}
+	return seconds * multiplier, true
+}
+
+// reservationWarnings returns what is allowed but likely unintended about the reservation of the named file.
+func reservationWarnings(name string, res reservation, idx *reservationIndex, leases map[string]string, force bool) []string {
+	var warnings []string
+	if force {
+		if err := idx.conflict(name, res); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+	if holder, leased := leases[ipv4Key(res.IPv4)]; leased && holder != name {
+		warnings = append(warnings, fmt.Sprintf("ipv4 %s is leased by %s", res.IPv4, holder))
+	}
+	if res.LeaseTime != "" {
+		if seconds, finite := leaseTimeSeconds(res.LeaseTime); finite && seconds < minimumLeaseTime {
+			warnings = append(warnings, fmt.Sprintf("lease_time %s is raised to 2m by Dnsmasq", res.LeaseTime))
+		}
+	}
+	return warnings
+}
+
+// dryRunReservation runs every check of POST /reservations on the input and adds it to idx when it passes.
+func dryRunReservation(input reservationInput, hostDir *hostDirectory, idx *reservationIndex, leases map[string]string, opts writeOptions) dryRunResult {
+	result := dryRunResult{MAC: input.MAC, Status: http.StatusBadRequest}
+	res := input.reservation()
+	err := binding.Validator.ValidateStruct(&input)
+	if err == nil {
+		err = input.checkPool()
+	}
+	if err == nil && input.IPv4 == autoIPv4 {
+		res, result.Status, err = allocateReservation(res, input.Pool, hostDir, idx)
+	}
+	var change reservationChange
+	if err == nil {
+		change, result.Status, err = prepareReservationFile(res, hostDir, idx, opts)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		errors.As(err, &result.Conflict)
+		errors.As(err, &result.Fields)
+		return result
+	}
+
+	result.MAC = change.Name
+	result.Valid = true
+	result.Line = strings.TrimSuffix(string(change.Content), "\n")
+	result.Warnings = reservationWarnings(change.Name, res, idx, leases, opts.force)
+	idx.set(change.Name, res)
+	return result
+}
+
+// validateReservations checks a reservation or an array of them as POST /reservations would without writing them.
+// The reservations in an array are checked against each other too.
+func validateReservations(c *gin.Context, hostDir *hostDirectory) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	var inputs []reservationInput
+	if batch {
+		err = json.Unmarshal(body, &inputs)
+	} else {
+		inputs = make([]reservationInput, 1)
+		err = json.Unmarshal(body, &inputs[0])
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Share the directory lock; nothing is written
+	hostDir.mu.RLock()
+	defer hostDir.mu.RUnlock()
+
+	reservations, err := readReservations(hostDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	leases, err := hostDir.leasedAddresses()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	idx := newReservationIndex(reservations)
+	opts := newWriteOptions(c, false)
+
+	status := http.StatusOK
+	results := make([]dryRunResult, len(inputs))
+	for i, input := range inputs {
+		if results[i] = dryRunReservation(input, hostDir, idx, leases, opts); !results[i].Valid {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	if batch {
+		c.JSON(status, results)
+	} else {
+		c.JSON(status, results[0])
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseTimeSeconds(t *testing.T) {
+	for leaseTime, expected := range map[string]int{"90": 90, "90s": 90, "1m": 60, "2H": 7200, "1d": 86400, "1w": 604800} {
+		seconds, finite := leaseTimeSeconds(leaseTime)
+		assert.True(t, finite, leaseTime)
+		assert.Equal(t, expected, seconds, leaseTime)
+	}
+	_, finite := leaseTimeSeconds("infinite")
+	assert.False(t, finite)
+}
+
+func TestValidateReservationEndpoint(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/validate", strings.NewReader(
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100", "hostname": "host1", "tags": ["iot"], "lease_time": "1m"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result dryRunResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Valid)
+	assert.Equal(t, http.StatusCreated, result.Status)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,set:iot,192.168.1.100,host1,1m", result.Line)
+	assert.Equal(t, []string{"lease_time 1m is raised to 2m by Dnsmasq"}, result.Warnings)
+
+	// Nothing is written
+	entries, _ := os.ReadDir("./test_hosts")
+	assert.Empty(t, entries)
+}
+
+func TestValidateReservationEndpointInvalid(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/validate", strings.NewReader(
+		`{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.300", "hostname": "foo,set:trusted"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var result dryRunResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(t, result.Valid)
+	assert.Equal(t, http.StatusBadRequest, result.Status)
+	assert.Empty(t, result.Line)
+	assert.Len(t, result.Fields, 2)
+}
+
+func TestValidateReservationsEndpoint(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e", []byte("00:1a:2b:3c:4d:5e,192.168.1.100,host1\n"), 0644)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/validate", strings.NewReader(`[
+		{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "192.168.1.100"},
+		{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.100"},
+		{"mac": "00:1A:2B:3C:4D:60", "ipv4": "auto", "pool": "192.168.1.100-102"},
+		{"mac": "00:1A:2B:3C:4D:61", "ipv4": "192.168.1.101"}
+	]`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var results []dryRunResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Len(t, results, 4)
+	assert.Equal(t, "exists", results[0].Error)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", results[1].Conflict.MAC)
+	assert.True(t, results[2].Valid)
+	assert.Equal(t, "00:1a:2b:3c:4d:60,192.168.1.101", results[2].Line)
+	// The reservations in the array conflict with each other too
+	assert.Equal(t, http.StatusConflict, results[3].Status)
+	assert.Equal(t, "00:1a:2b:3c:4d:60", results[3].Conflict.MAC)
+}
+
+func TestValidateReservationEndpointForce(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	os.WriteFile("./test_hosts/00:1a:2b:3c:4d:5e", []byte("00:1a:2b:3c:4d:5e,192.168.1.100,host1\n"), 0644)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations/validate?force=true", strings.NewReader(
+		`{"mac": "00:1A:2B:3C:4D:5F", "ipv4": "192.168.1.100"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ipv4 192.168.1.100 is reserved by 00:1a:2b:3c:4d:5e")
+}
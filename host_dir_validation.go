@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// hostnameLabelPattern matches one label of an RFC 1123 hostname.
+	hostnameLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	// tagPattern matches the tag names that are safe to write into a dhcp-host entry.
+	tagPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+	// clientIDPattern matches a client identifier in hexadecimal bytes, e.g., 01:00:1a:2b:3c:4d:5e, or as text,
+	// e.g., printer-1, which Dnsmasq accepts too; neither may end the field or the line it is written in.
+	clientIDPattern = regexp.MustCompile(`^[^,\s\x00-\x1f\x7f]+$`)
+)
+
+// maxMetadataLength is the most characters a metadata field may have.
+const maxMetadataLength = 1024
+
+// fieldError describes why the value of one field was rejected.
+type fieldError struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Error string `json:"error"`
+}
+
+// validationError lists every field of a reservation that was rejected.
+type validationError []fieldError
+
+func (e validationError) Error() string {
+	messages := make([]string, len(e))
+	for i, field := range e {
+		messages[i] = field.Error
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validateHostname returns an error unless the hostname follows RFC 1123 and cannot be mistaken for another field.
+func validateHostname(hostname string) error {
+	if len(hostname) > 253 {
+		return fmt.Errorf("invalid hostname: longer than 253 characters")
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if !hostnameLabelPattern.MatchString(label) {
+			return fmt.Errorf("invalid hostname: '%s' is not an RFC 1123 label", label)
+		}
+	}
+	if addr, err := validateIPv4(hostname); err == nil && addr.IsIPv4() {
+		return fmt.Errorf("invalid hostname: it is an IPv4 address")
+	}
+	if isLeaseTime(strings.ToLower(hostname)) || strings.EqualFold(hostname, "ignore") {
+		return fmt.Errorf("invalid hostname: it is a dhcp-host keyword or lease time")
+	}
+	return nil
+}
+
+// validateTag returns an error unless the tag has only letters, digits, underscores, dots and hyphens.
+func validateTag(tag string) error {
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag: only 1 to 64 letters, digits, '_', '.' and '-' are allowed")
+	}
+	return nil
+}
+
+// validateReservation checks every field and returns the reservation with its addresses normalized.
+// It returns a validationError that lists each rejected field.
+func validateReservation(input reservation) (reservation, error) {
+	var errs validationError
+	reject := func(field, value, message string) {
+		errs = append(errs, fieldError{Field: field, Value: value, Error: message})
+	}
+
+	if mac, err := validateMAC(input.MAC); err != nil {
+		reject("mac", input.MAC, "invalid MAC address")
+	} else {
+		input.MAC = mac.ToColonDelimitedString()
+	}
+	macs := make([]string, len(input.MACs))
+	for i, hwaddr := range input.MACs {
+		if hwaddrPattern.MatchString(hwaddr) {
+			macs[i] = normalizeHwaddr(hwaddr)
+		} else {
+			reject(fmt.Sprintf("macs[%d]", i), hwaddr, "invalid MAC address")
+		}
+	}
+	input.MACs = macs
+	if input.ClientID != "" && input.ClientID != "*" && !clientIDPattern.MatchString(input.ClientID) {
+		reject("client_id", input.ClientID, "invalid client identifier: it must be '*', hexadecimal bytes or text without commas, spaces or control characters")
+	}
+	for i, tag := range input.Tags {
+		if err := validateTag(tag); err != nil {
+			reject(fmt.Sprintf("tags[%d]", i), tag, err.Error())
+		}
+	}
+	for i, tag := range input.MatchTags {
+		if err := validateTag(strings.TrimPrefix(tag, "!")); err != nil {
+			reject(fmt.Sprintf("match_tags[%d]", i), tag, err.Error())
+		}
+	}
+	if input.IPv4 != "" {
+		if ipv4, err := validateIPv4(input.IPv4); err != nil || !ipv4.IsIPv4() || ipv4.IsPrefixed() {
+			reject("ipv4", input.IPv4, "invalid IPv4 address")
+		} else {
+			input.IPv4 = ipv4.String()
+		}
+	} else if len(input.IPv6) == 0 && !input.Ignore {
+		reject("ipv4", input.IPv4, "an IPv4 address is required")
+	}
+	for i, ipv6 := range input.IPv6 {
+		if addr, err := validateIPv4(ipv6); err != nil || !addr.IsIPv6() {
+			reject(fmt.Sprintf("ipv6[%d]", i), ipv6, "invalid IPv6 address")
+		}
+	}
+	if input.Hostname != "" {
+		if err := validateHostname(input.Hostname); err != nil {
+			reject("hostname", input.Hostname, err.Error())
+		}
+	}
+	if input.LeaseTime != "" && !isLeaseTime(input.LeaseTime) {
+		reject("lease_time", input.LeaseTime, "invalid lease time: it must be seconds, a number with s, m, h, d or w, or infinite")
+	}
+	for _, field := range []struct{ name, value string }{
+		{"description", input.Description}, {"owner", input.Owner}, {"asset_id", input.AssetID},
+	} {
+		if len(field.value) > maxMetadataLength {
+			reject(field.name, field.value, fmt.Sprintf("invalid %s: longer than %d characters", field.name, maxMetadataLength))
+		}
+	}
+	if input.OnExpiry != "" && input.OnExpiry != expiryDelete && input.OnExpiry != expiryIgnore {
+		reject("on_expiry", input.OnExpiry, "invalid on_expiry: it must be delete or ignore")
+	}
+
+	if len(errs) > 0 {
+		return input, errs
+	}
+	return input, nil
+}
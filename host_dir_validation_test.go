@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHostname(t *testing.T) {
+	for _, hostname := range []string{"host1", "Adam-s-Phone", "8e3d7e.lan", "a.example.com"} {
+		assert.NoError(t, validateHostname(hostname), hostname)
+	}
+	for _, hostname := range []string{"foo,set:trusted", "foo\nbar", "-foo", "foo-", "foo..bar", "192.168.1.1", "3600", "infinite", "ignore"} {
+		assert.Error(t, validateHostname(hostname), hostname)
+	}
+}
+
+func TestValidateReservation(t *testing.T) {
+	_, err := validateReservation(reservation{
+		MAC: "00:1A:2B:3C:4D:5E",
+		reservationData: reservationData{
+			IPv4:      "192.168.1.100",
+			Hostname:  "foo,set:trusted",
+			Tags:      []string{"safe", "bad\ntag"},
+			LeaseTime: "1 day",
+		},
+	})
+	assert.IsType(t, validationError{}, err)
+	fields := err.(validationError)
+	assert.Len(t, fields, 3)
+	assert.Equal(t, "tags[1]", fields[0].Field)
+	assert.Equal(t, "hostname", fields[1].Field)
+	assert.Equal(t, "lease_time", fields[2].Field)
+}
+
+func TestCreateReservationWithInjectedHostname(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/reservations", strings.NewReader(`{
+		"mac": "00:1A:2B:3C:4D:5E",
+		"ipv4": "192.168.1.100",
+		"hostname": "foo,set:trusted",
+		"lease_time": "24h\n00:1a:2b:3c:4d:5f,192.168.1.101"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoFileExists(t, filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+
+	var response struct {
+		Error  string       `json:"error"`
+		Fields []fieldError `json:"fields"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Fields, 2)
+	assert.Equal(t, "hostname", response.Fields[0].Field)
+	assert.Equal(t, "lease_time", response.Fields[1].Field)
+}
+
+func TestUpdateReservationWithInvalidTag(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{
+		"ipv4": "192.168.1.100",
+		"tags": ["ok", "trusted,ignore"]
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"tags[1]"`)
+	assert.NoFileExists(t, filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e"))
+}
+
+func TestValidateClientID(t *testing.T) {
+	for _, clientID := range []string{"*", "01:00:1a:2b:3c:4d:5e", "printer-1", "Office"} {
+		_, err := validateReservation(reservation{MAC: "00:1A:2B:3C:4D:5E", reservationData: reservationData{IPv4: "192.168.1.100", ClientID: clientID}})
+		assert.NoError(t, err, clientID)
+	}
+	for _, clientID := range []string{"foo,set:trusted", "foo bar", "foo\nbar", "foo\x7f"} {
+		_, err := validateReservation(reservation{MAC: "00:1A:2B:3C:4D:5E", reservationData: reservationData{IPv4: "192.168.1.100", ClientID: clientID}})
+		assert.Error(t, err, clientID)
+	}
+}
+
+func TestPatchReservationWithTextClientID(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	// Written by hand with a text client ID, which Dnsmasq accepts
+	path := filepath.Join("./test_hosts", "00:1a:2b:3c:4d:5e")
+	assert.NoError(t, os.WriteFile(path, []byte("00:1a:2b:3c:4d:5e,id:printer-1,192.168.1.100\n"), 0644))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/reservations/00:1A:2B:3C:4D:5E", strings.NewReader(`{"hostname": "printer"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e,id:printer-1,192.168.1.100,printer\n", string(content))
+}
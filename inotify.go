@@ -0,0 +1,70 @@
+package main
+
+import "os"
+
+// inotifyEvent is a change to the named file in a watched directory.
+type inotifyEvent struct {
+	name     string
+	overflow bool // events were lost, so everything must be read again
+	gone     bool // the watched directory was removed or moved, which ends the watch
+}
+
+// watchedDirectory keeps what is read from a directory up to date with the changes inotify reports.
+type watchedDirectory struct {
+	path    string
+	watcher *inotifyWatcher
+	watched os.FileInfo // the directory being watched, to notice when it is replaced
+}
+
+// refresh watches the directory and calls load the first time, or again when events were lost or the directory
+// was replaced, and otherwise calls changed with the name of each file that changed since the last refresh.
+// When the directory cannot be watched or load or changed fails, it stops watching and returns the error.
+func (wd *watchedDirectory) refresh(load func() error, changed func(name string) error) error {
+	if wd.watcher != nil {
+		if info, err := os.Stat(wd.path); err != nil || !os.SameFile(info, wd.watched) {
+			wd.reset()
+		}
+	}
+	if wd.watcher != nil {
+		events, err := wd.watcher.events()
+		if err != nil {
+			wd.reset()
+			return err
+		}
+		for _, event := range events {
+			if event.gone || event.overflow {
+				wd.reset()
+				break
+			}
+			if err := changed(event.name); err != nil {
+				wd.reset()
+				return err
+			}
+		}
+	}
+	if wd.watcher == nil {
+		info, err := os.Stat(wd.path)
+		if err != nil {
+			return err
+		}
+		watcher, err := newInotifyWatcher(wd.path)
+		if err != nil {
+			return err
+		}
+		wd.watcher, wd.watched = watcher, info
+		// Load after watching so no change is missed in between
+		if err := load(); err != nil {
+			wd.reset()
+			return err
+		}
+	}
+	return nil
+}
+
+// reset stops watching so the next refresh starts over.
+func (wd *watchedDirectory) reset() {
+	if wd.watcher != nil {
+		wd.watcher.close()
+	}
+	wd.watcher, wd.watched = nil, nil
+}
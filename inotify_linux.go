@@ -0,0 +1,63 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+
+// inotifyWatcher watches a directory without blocking, so a reader can apply every change made before it reads:
+// the kernel queues an event before the change that caused it returns.
+type inotifyWatcher struct {
+	fd int
+}
+
+func newInotifyWatcher(path string) (*inotifyWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unix.InotifyAddWatch(fd, path, inotifyMask); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &inotifyWatcher{fd: fd}, nil
+}
+
+// events returns the events queued since it was last called.
+func (w *inotifyWatcher) events() ([]inotifyEvent, error) {
+	var events []inotifyEvent
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err == unix.EINTR {
+			continue
+		} else if err == unix.EAGAIN {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			// struct inotify_event { int wd; uint32_t mask, cookie, len; char name[]; }
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			length := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			name := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+length]
+			events = append(events, inotifyEvent{
+				name:     string(bytes.TrimRight(name, "\x00")),
+				overflow: mask&unix.IN_Q_OVERFLOW != 0,
+				gone:     mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF|unix.IN_IGNORED) != 0,
+			})
+			offset += unix.SizeofInotifyEvent + length
+		}
+	}
+}
+
+func (w *inotifyWatcher) close() error {
+	return unix.Close(w.fd)
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// inotifyWatcher is unavailable outside Linux, so the files are read every time instead.
+type inotifyWatcher struct{}
+
+func newInotifyWatcher(path string) (*inotifyWatcher, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
+
+func (w *inotifyWatcher) events() ([]inotifyEvent, error) {
+	return nil, nil
+}
+
+func (w *inotifyWatcher) close() error {
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+// jsonPatchOperation is one operation of a JSON Patch (RFC 6902).
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchReservation returns the reservation with the patch applied.
+// The patch is a JSON Patch when the content type says so and a JSON Merge Patch otherwise.
+func patchReservation(res reservation, contentType string, patch []byte) (reservation, error) {
+	original, err := json.Marshal(res)
+	if err != nil {
+		return res, err
+	}
+	var doc any
+	if err := json.Unmarshal(original, &doc); err != nil {
+		return res, err
+	}
+
+	if contentType == mimeJSONPatch {
+		var operations []jsonPatchOperation
+		if err := json.Unmarshal(patch, &operations); err != nil {
+			return res, fmt.Errorf("invalid JSON Patch: %v", err)
+		}
+		if doc, err = applyJSONPatch(doc, operations); err != nil {
+			return res, err
+		}
+	} else {
+		var mergePatch any
+		if err := json.Unmarshal(patch, &mergePatch); err != nil {
+			return res, fmt.Errorf("invalid JSON Merge Patch: %v", err)
+		}
+		doc = applyMergePatch(doc, mergePatch)
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return res, err
+	}
+	var result reservation
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return res, fmt.Errorf("the patched reservation is invalid: %v", err)
+	}
+	return result, nil
+}
+
+// applyMergePatch applies a JSON Merge Patch (RFC 7396) to the target: null removes a member,
+// objects are merged recursively and every other value replaces the target.
+func applyMergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = applyMergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// applyJSONPatch applies the operations of a JSON Patch (RFC 6902) to the document in order.
+func applyJSONPatch(doc any, operations []jsonPatchOperation) (any, error) {
+	for i, operation := range operations {
+		path, err := jsonPointer(operation.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+		var value any
+		if operation.Op == "add" || operation.Op == "replace" || operation.Op == "test" {
+			if operation.Value == nil {
+				return nil, fmt.Errorf("operation %d: %s requires a value", i, operation.Op)
+			}
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return nil, fmt.Errorf("operation %d: %v", i, err)
+			}
+		}
+		switch operation.Op {
+		case "add":
+			doc, err = jsonPointerAdd(doc, path, value)
+		case "remove":
+			doc, _, err = jsonPointerRemove(doc, path)
+		case "replace":
+			if doc, _, err = jsonPointerRemove(doc, path); err == nil {
+				doc, err = jsonPointerAdd(doc, path, value)
+			}
+		case "move", "copy":
+			var from []string
+			if from, err = jsonPointer(operation.From); err != nil {
+				break
+			}
+			if operation.Op == "move" {
+				doc, value, err = jsonPointerRemove(doc, from)
+			} else {
+				value, err = jsonPointerGet(doc, from)
+			}
+			if err == nil {
+				doc, err = jsonPointerAdd(doc, path, value)
+			}
+		case "test":
+			var actual any
+			if actual, err = jsonPointerGet(doc, path); err == nil && !reflect.DeepEqual(actual, value) {
+				err = fmt.Errorf("test failed for %s", operation.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown op '%s'", operation.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// jsonPointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+func jsonPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON Pointer '%s'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex returns the index the token refers to in an array of the given length; "-" is the end.
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || index == length && !end {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	return index, nil
+}
+
+// jsonPointerGet returns the value at the path.
+func jsonPointerGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, exists := node[token]
+			if !exists {
+				return nil, fmt.Errorf("no member '%s'", token)
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("no member '%s'", token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonPointerAdd adds the value at the path, inserting it into arrays, and returns the changed document.
+func jsonPointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			node[path[0]] = value
+			return node, nil
+		}
+		child, exists := node[path[0]]
+		if !exists {
+			return nil, fmt.Errorf("no member '%s'", path[0])
+		}
+		child, err := jsonPointerAdd(child, path[1:], value)
+		node[path[0]] = child
+		return node, err
+	case []any:
+		index, err := arrayIndex(path[0], len(node), len(path) == 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			return append(node[:index], append([]any{value}, node[index:]...)...), nil
+		}
+		node[index], err = jsonPointerAdd(node[index], path[1:], value)
+		return node, err
+	}
+	return nil, fmt.Errorf("no member '%s'", path[0])
+}
+
+// jsonPointerRemove removes the value at the path and returns the changed document and the removed value.
+func jsonPointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	switch node := doc.(type) {
+	case map[string]any:
+		child, exists := node[path[0]]
+		if !exists {
+			return nil, nil, fmt.Errorf("no member '%s'", path[0])
+		}
+		if len(path) == 1 {
+			delete(node, path[0])
+			return node, child, nil
+		}
+		child, removed, err := jsonPointerRemove(child, path[1:])
+		node[path[0]] = child
+		return node, removed, err
+	case []any:
+		index, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := node[index]
+			return append(node[:index], node[index+1:]...), removed, nil
+		}
+		child, removed, err := jsonPointerRemove(node[index], path[1:])
+		node[index] = child
+		return node, removed, err
+	}
+	return nil, nil, fmt.Errorf("no member '%s'", path[0])
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	var target, patch any
+	json.Unmarshal([]byte(`{"a": "b", "c": {"d": "e", "f": "g"}, "tags": ["x"]}`), &target)
+	json.Unmarshal([]byte(`{"a": "z", "c": {"f": null}, "tags": ["y", "z"]}`), &patch)
+
+	result, _ := json.Marshal(applyMergePatch(target, patch))
+	assert.JSONEq(t, `{"a": "z", "c": {"d": "e"}, "tags": ["y", "z"]}`, string(result))
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"hostname": "host1", "tags": ["a", "b"]}`), &doc)
+
+	var operations []jsonPatchOperation
+	json.Unmarshal([]byte(`[
+		{"op": "test", "path": "/hostname", "value": "host1"},
+		{"op": "add", "path": "/tags/-", "value": "c"},
+		{"op": "remove", "path": "/tags/0"},
+		{"op": "replace", "path": "/hostname", "value": "host2"},
+		{"op": "copy", "from": "/hostname", "path": "/alias"},
+		{"op": "move", "from": "/alias", "path": "/name~1x"}
+	]`), &operations)
+
+	doc, err := applyJSONPatch(doc, operations)
+	assert.NoError(t, err)
+	result, _ := json.Marshal(doc)
+	assert.JSONEq(t, `{"hostname": "host2", "tags": ["b", "c"], "name/x": "host2"}`, string(result))
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	for _, patch := range []string{
+		`[{"op": "test", "path": "/hostname", "value": "other"}]`,
+		`[{"op": "remove", "path": "/missing"}]`,
+		`[{"op": "replace", "path": "/tags/5", "value": "x"}]`,
+		`[{"op": "add", "path": "hostname", "value": "x"}]`,
+		`[{"op": "add", "path": "/hostname"}]`,
+		`[{"op": "frobnicate", "path": "/hostname"}]`,
+	} {
+		var doc any
+		json.Unmarshal([]byte(`{"hostname": "host1", "tags": ["a"]}`), &doc)
+		var operations []jsonPatchOperation
+		json.Unmarshal([]byte(patch), &operations)
+		_, err := applyJSONPatch(doc, operations)
+		assert.Error(t, err, patch)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// sqliteTimeLayout is how the script writes the added and renewed times, in UTC like CURRENT_TIMESTAMP.
+	sqliteTimeLayout = "2006-01-02 15:04:05"
+	// leaseExpiresUnix is the expires column in seconds since the epoch, whether the script writes a number or a time.
+	leaseExpiresUnix = "CASE typeof(leases.expires) WHEN 'text' THEN unixepoch(leases.expires) ELSE leases.expires END"
+)
+
+// leaseDuration is a duration that is written as a string, e.g., "1h2m3s".
+type leaseDuration time.Duration
+
+func (d leaseDuration) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Duration(d).String() + `"`), nil
+}
+
+func (d leaseDuration) String() string {
+	return time.Duration(d).String()
+}
+
+// ActiveLease is a lease with the client that has it and its times computed when it is read.
+type ActiveLease struct {
+	Mac          string         `json:"mac"`
+	Hostname     string         `json:"hostname"`
+	ClientID     string         `json:"client_id"`
+	VendorClass  string         `json:"vendor_class"`
+	IPv4         string         `json:"ipv4"`
+	Added        string         `json:"added"`
+	Renewed      string         `json:"renewed"`
+	ExpiresUnix  *int64         `json:"-"`
+	Age          *leaseDuration `json:"age,omitempty" gorm:"-"`           // since it was added
+	SinceRenewed *leaseDuration `json:"since_renewed,omitempty" gorm:"-"` // since it was renewed, or added if never renewed
+	Expires      *time.Time     `json:"expires,omitempty" gorm:"-"`       // when it is known
+	Remaining    *leaseDuration `json:"remaining,omitempty" gorm:"-"`     // until it expires, 0 once it has
+}
+
+// parseLeaseTime returns the time the script wrote or nil when it is empty or invalid.
+func parseLeaseTime(value string) *time.Time {
+	t, err := time.ParseInLocation(sqliteTimeLayout, value, time.UTC)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// since returns the duration from then to now, rounded to the second.
+func since(then time.Time, now time.Time) *leaseDuration {
+	d := leaseDuration(now.Sub(then).Round(time.Second))
+	return &d
+}
+
+// setTimes computes the age, the time since the renewal and, when the expiry is known, the time remaining.
+// The added and renewed times are rewritten in RFC 3339, like the expiry, so every time has the same layout.
+func (l *ActiveLease) setTimes(now time.Time) {
+	if added := parseLeaseTime(l.Added); added != nil {
+		l.Added = added.Format(time.RFC3339)
+		l.Age = since(*added, now)
+		l.SinceRenewed = l.Age
+	}
+	if renewed := parseLeaseTime(l.Renewed); renewed != nil {
+		l.Renewed = renewed.Format(time.RFC3339)
+		l.SinceRenewed = since(*renewed, now)
+	}
+	if l.ExpiresUnix != nil {
+		expires := time.Unix(*l.ExpiresUnix, 0).UTC()
+		remaining := leaseDuration(max(expires.Sub(now).Round(time.Second), 0))
+		l.Expires, l.Remaining = &expires, &remaining
+	}
+}
+
+// csvRecord returns the columns of leaseCSVHeader, leaving those that are unknown empty.
+func (l ActiveLease) csvRecord() []string {
+	duration := func(d *leaseDuration) string {
+		if d == nil {
+			return ""
+		}
+		return d.String()
+	}
+	expires := ""
+	if l.Expires != nil {
+		expires = l.Expires.Format(time.RFC3339)
+	}
+	return []string{
+		l.Mac, l.IPv4, l.Hostname, l.ClientID, l.VendorClass, l.Added, l.Renewed,
+		duration(l.Age), duration(l.SinceRenewed), expires, duration(l.Remaining),
+	}
+}
+
+// whereLeaseTimes filters the leases by the older_than and expiring_within durations.
+// expiring_within requires the expiry of the leases, so it is a 501 without it.
+func whereLeaseTimes(c *gin.Context, db *gorm.DB, now time.Time, hasExpires bool) (*gorm.DB, bool) {
+	if value := c.Query("older_than"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than must be a duration, e.g., 24h"})
+			return nil, false
+		}
+		db = db.Where("unixepoch(leases.added) <= ?", now.Add(-d).Unix())
+	}
+	if value := c.Query("expiring_within"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiring_within must be a duration, e.g., 1h"})
+			return nil, false
+		}
+		if !hasExpires {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "expiring_within requires the expiry of the leases"})
+			return nil, false
+		}
+		db = db.Where(leaseExpiresUnix+" <= ?", now.Add(d).Unix())
+	}
+	return db, true
+}
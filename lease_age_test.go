@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLeaseTimes struct {
+	Mac          string     `json:"mac"`
+	Added        string     `json:"added"`
+	Age          string     `json:"age"`
+	SinceRenewed string     `json:"since_renewed"`
+	Expires      *time.Time `json:"expires"`
+	Remaining    string     `json:"remaining"`
+}
+
+func getLeaseTimes(t *testing.T, router *gin.Engine, url string) (int, []testLeaseTimes) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	router.ServeHTTP(w, req)
+
+	var leases []testLeaseTimes
+	if w.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &leases))
+	}
+	return w.Code, leases
+}
+
+func TestLeaseTimes(t *testing.T) {
+	router := setupRouter()
+
+	code, leases := getLeaseTimes(t, router, "/leases?sort=mac")
+	assert.Equal(t, http.StatusOK, code)
+	for _, lease := range leases {
+		age, err := time.ParseDuration(lease.Age)
+		assert.NoError(t, err)
+		sinceRenewed, err := time.ParseDuration(lease.SinceRenewed)
+		assert.NoError(t, err)
+		assert.Greater(t, age, sinceRenewed, lease.Mac)
+		added, err := time.Parse(time.RFC3339, lease.Added)
+		assert.NoError(t, err)
+		assert.Equal(t, time.UTC, added.Location())
+		assert.Nil(t, lease.Expires) // the test database has no expires column
+		assert.Empty(t, lease.Remaining)
+	}
+
+	// The leases were added on 2024-09-03, so they are all older than a day and none is older than 100 years
+	_, old := getLeaseTimes(t, router, "/leases?older_than=24h")
+	assert.Len(t, old, len(leases))
+	_, ancient := getLeaseTimes(t, router, "/leases?older_than=876000h")
+	assert.Empty(t, ancient)
+
+	code, _ = getLeaseTimes(t, router, "/leases?older_than=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = getLeaseTimes(t, router, "/leases?expiring_within=1h")
+	assert.Equal(t, http.StatusNotImplemented, code)
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := OpenLeaseDatabase(":memory:")
+	db.Exec(testDatabaseSQL)
+	db.Exec("ALTER TABLE leases ADD COLUMN expires")
+	now := time.Now().UTC()
+	// One lease expires in seconds since the epoch, another as text and the rest have already expired
+	db.Exec("UPDATE leases SET expires = ?", now.Add(-time.Hour).Unix())
+	db.Exec("UPDATE leases SET expires = ? WHERE mac = 'bc:32:b2:3b:13:d4'", now.Add(30*time.Minute).Unix())
+	db.Exec("UPDATE leases SET expires = ? WHERE mac = '64:b7:08:7a:44:10'",
+		now.Add(3*time.Hour).Format(sqliteTimeLayout))
+	router := LeaseDatabase(gin.Default(), db)
+
+	code, leases := getLeaseTimes(t, router, "/leases?sort=mac")
+	assert.Equal(t, http.StatusOK, code)
+	for _, lease := range leases {
+		assert.NotNil(t, lease.Expires, lease.Mac)
+		remaining, err := time.ParseDuration(lease.Remaining)
+		assert.NoError(t, err)
+		switch lease.Mac {
+		case "bc:32:b2:3b:13:d4":
+			assert.InDelta(t, 30*time.Minute, remaining, float64(5*time.Second))
+		case "64:b7:08:7a:44:10":
+			assert.InDelta(t, 3*time.Hour, remaining, float64(5*time.Second))
+		default:
+			assert.Zero(t, remaining, lease.Mac)
+		}
+	}
+
+	_, expiring := getLeaseTimes(t, router, "/leases?expiring_within=1h")
+	assert.Len(t, expiring, len(leases)-1)
+	for _, lease := range expiring {
+		assert.NotEqual(t, "64:b7:08:7a:44:10", lease.Mac)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/leases?format=csv&expiring_within=4h&older_than=24h&sort=mac&limit=1", nil)
+	router.ServeHTTP(w, req)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, leaseCSVHeader, records[0])
+	assert.Len(t, records, 2)
+	assert.Equal(t, fmt.Sprint(len(leaseCSVHeader)), fmt.Sprint(len(records[1])))
+	for _, column := range []int{5, 9} { // added and expires
+		_, err := time.Parse(time.RFC3339, records[1][column])
+		assert.NoError(t, err, leaseCSVHeader[column])
+	}
+}
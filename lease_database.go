@@ -1,13 +1,19 @@
 package main
 
 import (
+	"cmp"
+	"database/sql"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
 	"github.com/seancfoley/ipaddress-go/ipaddr"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -35,18 +41,71 @@ type Client struct {
 	Updated     string `json:"updated"`
 }
 
-// ipListFromExpression returns the list of IP addresses ipaddr derives from the expression.
-func ipListFromExpression(expression string) ([]string, error) {
-	ipRange, err := ipaddr.NewIPAddressString(expression).ToAddress()
+// ClientRequests is a client with the number of requests it made and the addresses it requested.
+type ClientRequests struct {
+	Client
+	Requests int      `json:"requests"`
+	IPv4s    []string `json:"ipv4s"`
+}
+
+// csvRecord returns the columns of clientCSVHeader.
+func (cr ClientRequests) csvRecord() []string {
+	return []string{
+		strconv.Itoa(cr.Requests), cr.Mac, cr.Hostname, strings.Join(cr.IPv4s, ","), cr.ClientID, cr.VendorClass, cr.Updated,
+	}
+}
+
+const (
+	// leaseDatabaseDriver is the SQLite driver with the functions the queries of the lease database use.
+	leaseDatabaseDriver = "sqlite3_dnsmasq_web"
+	// defaultMaxRequestRows is the most rows a /requests query reads unless -q sets another limit.
+	defaultMaxRequestRows = 10000
+)
+
+// maxRequestRows is the most rows a /requests query reads; a query matching more is rejected.
+var maxRequestRows = defaultMaxRequestRows
+
+func init() {
+	sql.Register(leaseDatabaseDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("ip_key", ipKey, true)
+		},
+	})
+}
+
+// ipKey returns the address as bytes that sort in numeric order, the IPv4 addresses before the IPv6 ones,
+// or nil when it is not an IP address.
+func ipKey(address string) []byte {
+	ip, err := netip.ParseAddr(address)
 	if err != nil {
-		return nil, err
+		return nil
 	}
+	return ipAddrKey(ip)
+}
 
-	var ipList []string
-	for ip := ipRange.Iterator(); ip.HasNext(); {
-		ipList = append(ipList, ip.Next().WithoutPrefixLen().String())
+// ipAddrKey returns the family of the address, 4 or 6, followed by its bytes.
+func ipAddrKey(ip netip.Addr) []byte {
+	if ip.Is4() {
+		return append([]byte{4}, ip.AsSlice()...)
 	}
-	return ipList, nil
+	return append([]byte{6}, ip.AsSlice()...)
+}
+
+// ipRangeFromExpression returns the keys of the lowest and highest addresses of the CIDR or range in the expression.
+func ipRangeFromExpression(expression string) ([]byte, []byte, error) {
+	ipRange, err := ipaddr.NewIPAddressString(expression).ToAddress()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ipRange.IsSequential() {
+		return nil, nil, fmt.Errorf("'%s' is not a contiguous range of addresses", expression)
+	}
+	return ipAddrKey(ipRange.GetNetNetIPAddr()), ipAddrKey(ipRange.GetUpperNetNetIPAddr()), nil
+}
+
+// OpenLeaseDatabase opens the SQLite database at path with the functions the lease database queries use.
+func OpenLeaseDatabase(path string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.New(sqlite.Config{DriverName: leaseDatabaseDriver, DSN: path}), &gorm.Config{})
 }
 
 func whereMac(a func(string) string, c *gin.Context, db *gorm.DB, name, field string, required bool) (*gorm.DB, bool) {
@@ -107,26 +166,25 @@ func whereSince(c *gin.Context, db *gorm.DB, oldest time.Time, name, field strin
 	return nil, false
 }
 
+// The CSV columns of the lists of the lease database
+var (
+	leaseCSVHeader = []string{
+		"mac", "ipv4", "hostname", "client_id", "vendor_class", "added", "renewed",
+		"age", "since_renewed", "expires", "remaining",
+	}
+	addressCSVHeader = []string{"ipv4", "first_seen", "last_seen", "requested_options", "hostname", "vendor_class"}
+	deviceCSVHeader  = []string{"mac", "first_seen", "last_seen", "requested_options", "hostname", "vendor_class"}
+	clientCSVHeader  = []string{"requests", "mac", "hostname", "ipv4s", "client_id", "vendor_class", "updated"}
+	requestCSVHeader = []string{"ipv4", "mac", "hostname", "vendor_class", "requested_options", "requested"}
+)
+
 func LeaseDatabase(r *gin.Engine, db *gorm.DB) *gin.Engine {
 	db.AutoMigrate(&Request{}, &Lease{}, &Client{})
 
-	r.GET("/leases", func(c *gin.Context) {
-		var active []struct {
-			Mac         string `json:"mac"`
-			Hostname    string `json:"hostname"`
-			ClientID    string `json:"client_id"`
-			VendorClass string `json:"vendor_class"`
-			IPv4        string `json:"ipv4"`
-			Added       string `json:"added"`
-			Renewed     string `json:"renewed"`
-		}
-		db.Table("clients as c").
-			Select("c.mac, c.hostname, c.client_id, c.vendor_class, leases.*").
-			Joins("right join leases on c.mac = leases.mac").
-			Scan(&active)
-
-		c.JSON(http.StatusOK, active)
-	})
+	// The script may keep the expiry of each lease, e.g., DNSMASQ_LEASE_EXPIRES, in an expires column
+	var expiresColumns int64
+	db.Raw("SELECT COUNT(*) FROM pragma_table_info('leases') WHERE name = 'expires'").Scan(&expiresColumns)
+	serveLeases(r, &leaseDatabase{db: db, hasExpires: expiresColumns > 0})
 
 	r.GET("/addresses/:mac", func(c *gin.Context) {
 		var requests []struct {
@@ -176,8 +234,24 @@ func LeaseDatabase(r *gin.Engine, db *gorm.DB) *gin.Engine {
 		for _, history := range ipHistory {
 			ipHistoryList = append(ipHistoryList, *history)
 		}
+		ipHistoryList, ok = paginate(c, ipHistoryList, listOrder[IPHistory]{
+			keys: []string{"first_seen", "last_seen", "ipv4"},
+			compare: map[string]func(a, b IPHistory) int{
+				"first_seen": func(a, b IPHistory) int { return strings.Compare(a.FirstSeen, b.FirstSeen) },
+				"last_seen":  func(a, b IPHistory) int { return strings.Compare(a.LastSeen, b.LastSeen) },
+				"ipv4":       func(a, b IPHistory) int { return ipv4Order(a.IPv4).Compare(ipv4Order(b.IPv4)) },
+			},
+			tiebreak: func(a, b IPHistory) int { return ipv4Order(a.IPv4).Compare(ipv4Order(b.IPv4)) },
+		})
+		if !ok {
+			return
+		}
 
-		c.JSON(http.StatusOK, ipHistoryList)
+		writeList(c, ipHistoryList, addressCSVHeader, func(history IPHistory) []string {
+			return []string{
+				history.IPv4, history.FirstSeen, history.LastSeen, history.RequestedOptions, history.Hostname, history.VendorClass,
+			}
+		})
 	})
 
 	r.GET("/devices/:ipv4", func(c *gin.Context) {
@@ -228,51 +302,24 @@ func LeaseDatabase(r *gin.Engine, db *gorm.DB) *gin.Engine {
 		for _, history := range macHistory {
 			macHistoryList = append(macHistoryList, *history)
 		}
-
-		c.JSON(http.StatusOK, macHistoryList)
-	})
-
-	r.GET("/clients", func(c *gin.Context) {
-		type ClientRequests struct {
-			Client
-			Requests int      `json:"requests"`
-			IPv4s    []string `json:"ipv4s"`
-		}
-
-		subQuery := db.Table("requests").
-			Select("mac, GROUP_CONCAT(DISTINCT ipv4 ORDER BY ipv4) as ipv4s").
-			Group("mac")
-
-		query := db.Table("requests as r").
-			Select("clients.*, COUNT(r.mac) as requests, sub.ipv4s").
-			Joins("LEFT JOIN clients ON clients.mac = r.mac").
-			Joins("LEFT JOIN (?) as sub ON clients.mac = sub.mac", subQuery).
-			Group("r.mac").
-			Order("requests")
-
-		var ok bool
-		if query, ok = whereSince(c, query, time.Time{}, "since", "r.received", false); !ok {
+		macHistoryList, ok = paginate(c, macHistoryList, listOrder[MacHistory]{
+			keys: []string{"first_seen", "last_seen", "mac"},
+			compare: map[string]func(a, b MacHistory) int{
+				"first_seen": func(a, b MacHistory) int { return strings.Compare(a.FirstSeen, b.FirstSeen) },
+				"last_seen":  func(a, b MacHistory) int { return strings.Compare(a.LastSeen, b.LastSeen) },
+				"mac":        func(a, b MacHistory) int { return strings.Compare(a.Mac, b.Mac) },
+			},
+			tiebreak: func(a, b MacHistory) int { return strings.Compare(a.Mac, b.Mac) },
+		})
+		if !ok {
 			return
 		}
 
-		var queryResults []struct {
-			Client
-			Requests int    `json:"requests"`
-			IPv4s    string `json:"ipv4s"`
-		}
-		query.Scan(&queryResults)
-
-		// Convert the comma-separated IPv4s string to a slice of strings
-		var results []ClientRequests = make([]ClientRequests, len(queryResults))
-		for i, result := range queryResults {
-			results[i].Client = result.Client
-			results[i].Requests = result.Requests
-			if result.IPv4s != "" {
-				results[i].IPv4s = strings.Split(result.IPv4s, ",")
+		writeList(c, macHistoryList, deviceCSVHeader, func(history MacHistory) []string {
+			return []string{
+				history.Mac, history.FirstSeen, history.LastSeen, history.RequestedOptions, history.Hostname, history.VendorClass,
 			}
-		}
-
-		c.JSON(http.StatusOK, results)
+		})
 	})
 
 	r.GET("/requests", func(c *gin.Context) {
@@ -286,21 +333,17 @@ func LeaseDatabase(r *gin.Engine, db *gorm.DB) *gin.Engine {
 			return
 		}
 
-		var err error // to avoid a type error in ipListFromExpression
-		var ipStrings []string
-
-		if cidr != "" {
-			ipStrings, err = ipListFromExpression(cidr)
-		} else if ipRange != "" {
-			ipStrings, err = ipListFromExpression(ipRange)
+		expression := cidr
+		if expression == "" {
+			expression = ipRange
 		}
-
+		lower, upper, err := ipRangeFromExpression(expression)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		var lastIPs []struct {
+		type lastIP struct {
 			IPv4             string `json:"ipv4"`
 			Mac              string `json:"mac"`
 			Hostname         string `json:"hostname"`
@@ -313,15 +356,42 @@ func LeaseDatabase(r *gin.Engine, db *gorm.DB) *gin.Engine {
 		query := db.Table("requests as r").
 			Select("r.ipv4, r.mac, c.hostname, c.vendor_class, r.requested_options,MAX(r.received) as requested").
 			Joins("JOIN clients as c ON r.mac = c.mac").
-			Where("r.ipv4 IN ?", ipStrings).
-			Group("r.ipv4, r.mac, c.hostname, c.vendor_class, r.requested_options").
-			Order("requested")
+			Where("ip_key(r.ipv4) BETWEEN ? AND ?", lower, upper).
+			Group("r.ipv4, r.mac, c.hostname, c.vendor_class, r.requested_options")
 
 		var ok bool
 		if query, ok = whereSince(c, query, time.Time{}, "since", "r.received", false); !ok {
 			return
 		}
-		query.Debug().Scan(&lastIPs)
+
+		// A stream has a row per request, which is never all in memory, so -q does not limit it
+		if listFormat(c) != gin.MIMEJSON {
+			p, ok := requestedPage(c, []string{"ipv4"})
+			if !ok {
+				return
+			}
+			if query, ok = p.pageQuery(c, query, map[string]string{"ipv4": "ip_key(r.ipv4)"}, "requested"); !ok {
+				return
+			}
+			streamRows(c, query, requestCSVHeader, func(entry lastIP) (any, []string) {
+				return entry, []string{
+					entry.IPv4, entry.Mac, entry.Hostname, entry.VendorClass, entry.RequestedOptions, entry.Requested,
+				}
+			})
+			return
+		}
+
+		var lastIPs []lastIP
+		if err := query.Order("requested").Limit(maxRequestRows + 1).Scan(&lastIPs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(lastIPs) > maxRequestRows {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": fmt.Sprintf("more than %d requests match; narrow the cidr or range or set since", maxRequestRows),
+			})
+			return
+		}
 
 		type groupedResult struct {
 			Mac              string `json:"mac"`
@@ -333,8 +403,12 @@ func LeaseDatabase(r *gin.Engine, db *gorm.DB) *gin.Engine {
 
 		// Group the results by IPv4
 		groupedResults := make(map[string][]groupedResult)
+		var ipv4s []string
 
 		for _, entry := range lastIPs {
+			if _, exists := groupedResults[entry.IPv4]; !exists {
+				ipv4s = append(ipv4s, entry.IPv4)
+			}
 			groupedResults[entry.IPv4] = append(
 				groupedResults[entry.IPv4],
 				groupedResult{
@@ -347,8 +421,175 @@ func LeaseDatabase(r *gin.Engine, db *gorm.DB) *gin.Engine {
 			)
 		}
 
-		c.JSON(http.StatusOK, groupedResults)
+		// Paginate the addresses, keeping every request for each of them
+		ipv4s, ok = paginate(c, ipv4s, listOrder[string]{
+			keys:     []string{"ipv4"},
+			compare:  map[string]func(a, b string) int{"ipv4": func(a, b string) int { return ipv4Order(a).Compare(ipv4Order(b)) }},
+			tiebreak: strings.Compare,
+		})
+		if !ok {
+			return
+		}
+		pagedResults := make(map[string][]groupedResult, len(ipv4s))
+		for _, ipv4 := range ipv4s {
+			pagedResults[ipv4] = groupedResults[ipv4]
+		}
+
+		c.JSON(http.StatusOK, pagedResults)
 	})
 
 	return r
 }
+
+// leaseDatabase serves the leases and clients from the SQLite database the script maintains.
+type leaseDatabase struct {
+	db         *gorm.DB
+	hasExpires bool // the leases table has the expiry of each lease
+}
+
+// leased returns the MAC that leases each IPv4 address.
+func (ld *leaseDatabase) leased() (map[string]string, error) {
+	var leases []Lease
+	if err := ld.db.Find(&leases).Error; err != nil {
+		return nil, err
+	}
+	leased := make(map[string]string, len(leases))
+	for _, lease := range leases {
+		if mac, err := validateMAC(lease.Mac); err == nil {
+			leased[ipv4Key(lease.IPv4)] = mac.ToNormalizedString()
+		}
+	}
+	return leased, nil
+}
+
+// getLeases responds with the active leases and the clients that have them.
+func (ld *leaseDatabase) getLeases(c *gin.Context) {
+	keys := []string{"added", "renewed", "mac", "ipv4", "hostname"}
+	columns := "c.mac, c.hostname, c.client_id, c.vendor_class, leases.*"
+	if ld.hasExpires {
+		columns += ", " + leaseExpiresUnix + " as expires_unix"
+	}
+	query := ld.db.Table("clients as c").
+		Select(columns).
+		Joins("right join leases on c.mac = leases.mac")
+
+	now := time.Now()
+	var ok bool
+	if query, ok = whereLeaseTimes(c, query, now, ld.hasExpires); !ok {
+		return
+	}
+
+	if listFormat(c) != gin.MIMEJSON {
+		p, ok := requestedPage(c, keys)
+		if !ok {
+			return
+		}
+		if query, ok = p.pageQuery(c, query, map[string]string{
+			"added": "leases.added", "renewed": "leases.renewed", "mac": "leases.mac",
+			"ipv4": "ip_key(leases.ipv4)", "hostname": "c.hostname",
+		}, "leases.mac"); !ok {
+			return
+		}
+		streamRows(c, query, leaseCSVHeader, func(lease ActiveLease) (any, []string) {
+			lease.setTimes(now)
+			return lease, lease.csvRecord()
+		})
+		return
+	}
+
+	var active []ActiveLease
+	query.Scan(&active)
+	for i := range active {
+		active[i].setTimes(now)
+	}
+
+	active, ok = paginate(c, active, listOrder[ActiveLease]{
+		keys: keys,
+		compare: map[string]func(a, b ActiveLease) int{
+			"added":    func(a, b ActiveLease) int { return strings.Compare(a.Added, b.Added) },
+			"renewed":  func(a, b ActiveLease) int { return strings.Compare(a.Renewed, b.Renewed) },
+			"mac":      func(a, b ActiveLease) int { return strings.Compare(a.Mac, b.Mac) },
+			"ipv4":     func(a, b ActiveLease) int { return ipv4Order(a.IPv4).Compare(ipv4Order(b.IPv4)) },
+			"hostname": func(a, b ActiveLease) int { return strings.Compare(a.Hostname, b.Hostname) },
+		},
+		tiebreak: func(a, b ActiveLease) int { return strings.Compare(a.Mac, b.Mac) },
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, active)
+}
+
+// getClients responds with the clients, the number of requests each made and the addresses it requested.
+func (ld *leaseDatabase) getClients(c *gin.Context) {
+	subQuery := ld.db.Table("requests").
+		Select("mac, GROUP_CONCAT(DISTINCT ipv4 ORDER BY ipv4) as ipv4s").
+		Group("mac")
+
+	query := ld.db.Table("requests as r").
+		Select("clients.*, COUNT(r.mac) as requests, sub.ipv4s").
+		Joins("LEFT JOIN clients ON clients.mac = r.mac").
+		Joins("LEFT JOIN (?) as sub ON clients.mac = sub.mac", subQuery).
+		Group("r.mac")
+
+	var ok bool
+	if query, ok = whereSince(c, query, time.Time{}, "since", "r.received", false); !ok {
+		return
+	}
+
+	type queryResult struct {
+		Client
+		Requests int    `json:"requests"`
+		IPv4s    string `json:"ipv4s"`
+	}
+	// Convert the comma-separated IPv4s string to a slice of strings
+	clientRequests := func(result queryResult) ClientRequests {
+		client := ClientRequests{Client: result.Client, Requests: result.Requests}
+		if result.IPv4s != "" {
+			client.IPv4s = strings.Split(result.IPv4s, ",")
+		}
+		return client
+	}
+	keys := []string{"requests", "mac", "hostname", "updated"}
+
+	if listFormat(c) != gin.MIMEJSON {
+		p, ok := requestedPage(c, keys)
+		if !ok {
+			return
+		}
+		if query, ok = p.pageQuery(c, query, map[string]string{
+			"requests": "requests", "mac": "clients.mac", "hostname": "clients.hostname", "updated": "clients.updated",
+		}, "clients.mac"); !ok {
+			return
+		}
+		streamRows(c, query, clientCSVHeader, func(result queryResult) (any, []string) {
+			client := clientRequests(result)
+			return client, client.csvRecord()
+		})
+		return
+	}
+
+	var queryResults []queryResult
+	query.Scan(&queryResults)
+
+	var results []ClientRequests = make([]ClientRequests, len(queryResults))
+	for i, result := range queryResults {
+		results[i] = clientRequests(result)
+	}
+	results, ok = paginate(c, results, listOrder[ClientRequests]{
+		keys: keys,
+		compare: map[string]func(a, b ClientRequests) int{
+			"requests": func(a, b ClientRequests) int { return cmp.Compare(a.Requests, b.Requests) },
+			"mac":      func(a, b ClientRequests) int { return strings.Compare(a.Mac, b.Mac) },
+			"hostname": func(a, b ClientRequests) int { return strings.Compare(a.Hostname, b.Hostname) },
+			"updated":  func(a, b ClientRequests) int { return strings.Compare(a.Updated, b.Updated) },
+		},
+		tiebreak: func(a, b ClientRequests) int { return strings.Compare(a.Mac, b.Mac) },
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
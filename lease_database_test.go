@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -8,13 +9,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
 func setupRouter() *gin.Engine {
 	r := gin.Default()
-	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, _ := OpenLeaseDatabase(":memory:")
 
 	db.Exec(testDatabaseSQL)
 
@@ -44,7 +43,7 @@ func TestLeasesEndpoint(t *testing.T) {
 	assert.NotEmpty(t, response)
 	assert.Equal(t, "44:4f:8e:ce:fa:64", response[0].Mac)
 	assert.Equal(t, "192.168.1.143", response[0].IPv4)
-	assert.Equal(t, "2024-09-03 12:57:54", response[0].Renewed)
+	assert.Equal(t, "2024-09-03T12:57:54Z", response[0].Renewed)
 }
 
 func TestAddressesEndpoint(t *testing.T) {
@@ -162,3 +161,62 @@ func TestRequestsEndpointRange(t *testing.T) {
 	assert.Contains(t, response, "192.168.1.9")
 	assert.Equal(t, "Adam-s-Phone", response["192.168.1.9"][0].Hostname)
 }
+
+func TestIPRangeFromExpression(t *testing.T) {
+	lower, upper, err := ipRangeFromExpression("192.168.0.0/16")
+	assert.NoError(t, err)
+	assert.Equal(t, ipKey("192.168.0.0"), lower)
+	assert.Equal(t, ipKey("192.168.255.255"), upper)
+
+	lower, upper, err = ipRangeFromExpression("192.168.1.1-15")
+	assert.NoError(t, err)
+	assert.Equal(t, ipKey("192.168.1.1"), lower)
+	assert.Equal(t, ipKey("192.168.1.15"), upper)
+
+	lower, upper, err = ipRangeFromExpression("2001:db8::/32")
+	assert.NoError(t, err)
+	assert.Equal(t, ipKey("2001:db8::"), lower)
+	assert.Equal(t, ipKey("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"), upper)
+
+	_, _, err = ipRangeFromExpression("192.168.1-2.1-3")
+	assert.Error(t, err)
+	_, _, err = ipRangeFromExpression("not an address")
+	assert.Error(t, err)
+
+	assert.Nil(t, ipKey("not an address"))
+	assert.Negative(t, bytes.Compare(ipKey("192.168.1.9"), ipKey("192.168.1.90")))
+}
+
+func TestRequestsEndpointLargePrefix(t *testing.T) {
+	router := setupRouter()
+
+	for _, url := range []string{"/requests?cidr=0.0.0.0/0", "/requests?cidr=::/0"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, url)
+		var response map[string][]struct {
+			Mac string `json:"mac"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		if url == "/requests?cidr=0.0.0.0/0" {
+			assert.Contains(t, response, "192.168.1.9")
+		} else {
+			assert.Empty(t, response)
+		}
+	}
+}
+
+func TestRequestsEndpointRowLimit(t *testing.T) {
+	router := setupRouter()
+	defer func() { maxRequestRows = defaultMaxRequestRows }()
+	maxRequestRows = 1
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/requests?cidr=192.168.1.0/24", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "more than 1 requests match")
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// leaseFile serves the leases and clients from the lease file of Dnsmasq, e.g., /var/lib/misc/dnsmasq.leases,
+// for when there is no database. It keeps the leases in memory and reads the file again when inotify reports
+// that it changed or, without inotify, every time.
+type leaseFile struct {
+	mu        sync.Mutex
+	path      string
+	directory watchedDirectory // the directory of the file, since Dnsmasq replaces the file
+	leases    []ActiveLease    // nil until read
+}
+
+// parseLeaseFile reads the IPv4 leases in the lines "<expiry> <mac> <ipv4> <hostname> <client-id>",
+// where an expiry of 0 is a lease that never expires and * is a hostname or client ID that is unknown.
+// It skips the IPv6 leases after the "duid" line and any line it cannot parse.
+func parseLeaseFile(r io.Reader) ([]ActiveLease, error) {
+	leases := []ActiveLease{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == "duid" {
+			break
+		}
+		if len(fields) < 4 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if ip, err := netip.ParseAddr(fields[2]); err != nil || !ip.Is4() {
+			continue
+		}
+		lease := ActiveLease{Mac: fields[1], IPv4: fields[2]}
+		if fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "*" {
+			lease.ClientID = fields[4]
+		}
+		if expiry != 0 {
+			lease.ExpiresUnix = &expiry
+		}
+		leases = append(leases, lease)
+	}
+	return leases, scanner.Err()
+}
+
+// readLeaseFile returns the leases in the file at path, none when it does not exist yet.
+func readLeaseFile(path string) ([]ActiveLease, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []ActiveLease{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseLeaseFile(file)
+}
+
+// read returns a copy of the leases after bringing them up to date.
+func (lf *leaseFile) read() ([]ActiveLease, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if err := lf.refresh(); err != nil {
+		return readLeaseFile(lf.path)
+	}
+	return slices.Clone(lf.leases), nil
+}
+
+// refresh reads the file the first time, or again when events were lost or its directory was replaced,
+// and otherwise reads it again only when it changed.
+func (lf *leaseFile) refresh() error {
+	stale := false
+	err := lf.directory.refresh(func() error {
+		stale = true
+		return nil
+	}, func(name string) error {
+		stale = stale || name == filepath.Base(lf.path)
+		return nil
+	})
+	if err == nil && stale {
+		if lf.leases, err = readLeaseFile(lf.path); err != nil {
+			lf.directory.reset()
+		}
+	}
+	return err
+}
+
+// leased returns the MAC that leases each IPv4 address in the file.
+func (lf *leaseFile) leased() (map[string]string, error) {
+	leases, err := lf.read()
+	if err != nil {
+		return nil, err
+	}
+	leased := make(map[string]string, len(leases))
+	for _, lease := range leases {
+		if mac, err := validateMAC(lease.Mac); err == nil {
+			leased[ipv4Key(lease.IPv4)] = mac.ToNormalizedString()
+		}
+	}
+	return leased, nil
+}
+
+// compareExpires orders the leases by expiry, those that never expire last.
+func compareExpires(a, b ActiveLease) int {
+	switch {
+	case a.ExpiresUnix == nil && b.ExpiresUnix == nil:
+		return 0
+	case a.ExpiresUnix == nil:
+		return 1
+	case b.ExpiresUnix == nil:
+		return -1
+	}
+	return cmp.Compare(*a.ExpiresUnix, *b.ExpiresUnix)
+}
+
+// getLeases responds with the leases in the file.
+// The file has no added or renewed times, so there is no age and older_than is not implemented.
+func (lf *leaseFile) getLeases(c *gin.Context) {
+	leases, err := lf.read()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("older_than") != "" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "older_than requires the lease database (-f)"})
+		return
+	}
+
+	now := time.Now()
+	active := []ActiveLease{}
+	var within *time.Duration
+	if value := c.Query("expiring_within"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiring_within must be a duration, e.g., 1h"})
+			return
+		}
+		within = &d
+	}
+	for _, lease := range leases {
+		if within != nil && (lease.ExpiresUnix == nil || *lease.ExpiresUnix > now.Add(*within).Unix()) {
+			continue
+		}
+		lease.setTimes(now)
+		active = append(active, lease)
+	}
+
+	active, ok := paginate(c, active, listOrder[ActiveLease]{
+		keys: []string{"expires", "mac", "ipv4", "hostname"},
+		compare: map[string]func(a, b ActiveLease) int{
+			"expires":  compareExpires,
+			"mac":      func(a, b ActiveLease) int { return strings.Compare(a.Mac, b.Mac) },
+			"ipv4":     func(a, b ActiveLease) int { return ipv4Order(a.IPv4).Compare(ipv4Order(b.IPv4)) },
+			"hostname": func(a, b ActiveLease) int { return strings.Compare(a.Hostname, b.Hostname) },
+		},
+		tiebreak: func(a, b ActiveLease) int { return strings.Compare(a.Mac, b.Mac) },
+	})
+	if !ok {
+		return
+	}
+	writeList(c, active, leaseCSVHeader, ActiveLease.csvRecord)
+}
+
+// getClients responds with a client for each MAC in the file with the addresses it leases.
+// The file has no requests, so their number is 0 and since is not implemented.
+func (lf *leaseFile) getClients(c *gin.Context) {
+	leases, err := lf.read()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("since") != "" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "since requires the lease database (-f)"})
+		return
+	}
+
+	clients := []ClientRequests{}
+	index := make(map[string]int)
+	for _, lease := range leases {
+		if i, exists := index[lease.Mac]; exists {
+			clients[i].IPv4s = append(clients[i].IPv4s, lease.IPv4)
+			continue
+		}
+		index[lease.Mac] = len(clients)
+		clients = append(clients, ClientRequests{
+			Client: Client{Mac: lease.Mac, Hostname: lease.Hostname, ClientID: lease.ClientID},
+			IPv4s:  []string{lease.IPv4},
+		})
+	}
+
+	clients, ok := paginate(c, clients, listOrder[ClientRequests]{
+		keys: []string{"mac", "hostname"},
+		compare: map[string]func(a, b ClientRequests) int{
+			"mac":      func(a, b ClientRequests) int { return strings.Compare(a.Mac, b.Mac) },
+			"hostname": func(a, b ClientRequests) int { return strings.Compare(a.Hostname, b.Hostname) },
+		},
+		tiebreak: func(a, b ClientRequests) int { return strings.Compare(a.Mac, b.Mac) },
+	})
+	if !ok {
+		return
+	}
+	writeList(c, clients, clientCSVHeader, ClientRequests.csvRecord)
+}
+
+// LeaseFile adds the /leases and /clients endpoints, served from the Dnsmasq lease file at leaseFilePath
+// rather than the database. With the host directory (not empty), new reservations with ipv4 auto also avoid
+// the leased addresses.
+func LeaseFile(r *gin.Engine, leaseFilePath, hostDirPath string) *gin.Engine {
+	lf := &leaseFile{path: leaseFilePath, directory: watchedDirectory{path: filepath.Dir(leaseFilePath)}}
+	// Read the leases now rather than on the first request
+	lf.mu.Lock()
+	if err := lf.refresh(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to watch the lease file, reading it for every request instead: %v\n", err)
+	}
+	lf.mu.Unlock()
+
+	serveLeases(r, lf)
+	if hostDirPath != "" {
+		avoidLeases(hostDirPath, lf)
+	}
+	return r
+}
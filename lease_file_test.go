@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testLeaseFile = `%d bc:32:b2:3b:13:d4 192.168.1.9 Adam-s-Phone 01:bc:32:b2:3b:13:d4
+%d 6c:29:90:2a:a4:03 192.168.1.105 wiz_2aa403 *
+0 84:28:59:86:57:36 192.168.1.208 * 01:84:28:59:86:57:36
+not a lease
+duid 00:01:00:01:2c:5e:1d:3a:52:54:00:12:34:56
+%d 1234567 fd00::9 Adam-s-Phone 00:01:00:01:2c:5e:1d:3a:bc:32:b2:3b:13:d4
+`
+
+func writeTestLeaseFile(t *testing.T, path string, now time.Time) {
+	content := fmt.Sprintf(testLeaseFile, now.Add(30*time.Minute).Unix(), now.Add(6*time.Hour).Unix(), now.Unix())
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestParseLeaseFile(t *testing.T) {
+	now := time.Now()
+	leases, err := parseLeaseFile(strings.NewReader(fmt.Sprintf(testLeaseFile, now.Unix(), now.Unix(), now.Unix())))
+	assert.NoError(t, err)
+	assert.Len(t, leases, 3)
+
+	assert.Equal(t, "bc:32:b2:3b:13:d4", leases[0].Mac)
+	assert.Equal(t, "192.168.1.9", leases[0].IPv4)
+	assert.Equal(t, "Adam-s-Phone", leases[0].Hostname)
+	assert.Equal(t, "01:bc:32:b2:3b:13:d4", leases[0].ClientID)
+	assert.Equal(t, now.Unix(), *leases[0].ExpiresUnix)
+	assert.Empty(t, leases[1].ClientID)
+	assert.Empty(t, leases[2].Hostname)
+	assert.Nil(t, leases[2].ExpiresUnix) // an infinite lease
+}
+
+func TestLeaseFileEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dnsmasq.leases")
+	writeTestLeaseFile(t, path, time.Now())
+	r := LeaseFile(gin.Default(), path, "")
+
+	get := func(url string, v any) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		r.ServeHTTP(w, req)
+		if v != nil && w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+		return w.Code
+	}
+
+	var leases []testLeaseTimes
+	assert.Equal(t, http.StatusOK, get("/leases", &leases))
+	assert.Len(t, leases, 3)
+	// Ordered by expiry, the infinite lease last
+	assert.Equal(t, "bc:32:b2:3b:13:d4", leases[0].Mac)
+	assert.Equal(t, "84:28:59:86:57:36", leases[2].Mac)
+	assert.Nil(t, leases[2].Expires)
+	remaining, err := time.ParseDuration(leases[0].Remaining)
+	assert.NoError(t, err)
+	assert.InDelta(t, 30*time.Minute, remaining, float64(5*time.Second))
+	assert.Empty(t, leases[0].Age)
+
+	assert.Equal(t, http.StatusOK, get("/leases?expiring_within=1h", &leases))
+	assert.Len(t, leases, 1)
+	assert.Equal(t, http.StatusNotImplemented, get("/leases?older_than=1h", nil))
+	assert.Equal(t, http.StatusBadRequest, get("/leases?sort=added", nil))
+
+	var clients []ClientRequests
+	assert.Equal(t, http.StatusOK, get("/clients?sort=hostname", &clients))
+	assert.Len(t, clients, 3)
+	assert.Equal(t, "", clients[0].Hostname)
+	assert.Equal(t, []string{"192.168.1.9"}, clients[1].IPv4s)
+	assert.Equal(t, http.StatusNotImplemented, get("/clients?since=2024-09-03", nil))
+
+	// Dnsmasq rewrites the file as leases change
+	assert.NoError(t, os.WriteFile(path, []byte("0 00:1a:2b:3c:4d:5e 192.168.1.50 new *\n"), 0644))
+	assert.Equal(t, http.StatusOK, get("/leases", &leases))
+	assert.Len(t, leases, 1)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", leases[0].Mac)
+
+	assert.NoError(t, os.Remove(path))
+	assert.Equal(t, http.StatusOK, get("/leases", &leases))
+	assert.Empty(t, leases)
+}
+
+func TestLeaseFileAvoidedByAutoIPv4(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	writeTestLeaseFile(t, path, time.Now())
+	os.Mkdir("./test_hosts", 0755)
+	defer removeTestHostDir()
+	defer func() { openHostDirectory("./test_hosts").leases = nil }()
+	r := newRouter(nil, nil, path, "./test_hosts")
+
+	// 192.168.1.9 is leased to another MAC
+	w := sendTestRequest(r, "POST", "/reservations", "", `{"mac": "00:1A:2B:3C:4D:5E", "ipv4": "auto", "pool": "192.168.1.9-20"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"ipv4":"192.168.1.10"`)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// leaseProvider serves the active leases and the clients that have them
+// from the database the script maintains or from the lease file of Dnsmasq.
+type leaseProvider interface {
+	getLeases(c *gin.Context)
+	getClients(c *gin.Context)
+	leased() (map[string]string, error) // the MAC that leases each IPv4 address
+}
+
+// serveLeases adds the routes of the lease provider.
+func serveLeases(r *gin.Engine, lp leaseProvider) {
+	r.GET("/leases", lp.getLeases)
+	r.GET("/clients", lp.getClients)
+}
+
+// avoidLeases makes the reservations in the host directory avoid the addresses the lease provider leases,
+// e.g., those allocated by ipv4 auto.
+func avoidLeases(hostDirPath string, lp leaseProvider) {
+	openHostDirectory(hostDirPath).leases = lp.leased
+}
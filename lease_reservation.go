@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// reserveLease creates a reservation for the IPv4 address and hostname of the active lease of the MAC.
+// The body may add tags and a lease time.
+func reserveLease(c *gin.Context, db *gorm.DB, hostDir *hostDirectory) {
+	var input struct {
+		Tags      []string `json:"tags"`
+		LeaseTime string   `json:"lease_time"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	query, ok := whereMac(c.Param, c, db.Table("leases as l"), "mac", "l.mac", true)
+	if !ok {
+		return
+	}
+	var lease struct {
+		Mac      string
+		IPv4     string
+		Hostname string
+	}
+	err := query.Select("l.mac, l.ipv4, ifnull(c.hostname, '') as hostname").
+		Joins("LEFT JOIN clients as c ON c.mac = l.mac").
+		Take(&lease).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no active lease"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := reservation{MAC: lease.Mac, reservationData: reservationData{
+		Tags:      input.Tags,
+		IPv4:      lease.IPv4,
+		Hostname:  lease.Hostname,
+		LeaseTime: input.LeaseTime,
+	}}
+	opts := newWriteOptions(c, false)
+	opts.operation = "reserve"
+	if status, err := writeReservationFile(res, hostDir, opts); err != nil {
+		c.JSON(status, errorResponse(err))
+	} else {
+		c.JSON(status, gin.H{"message": "success", "reservation": res})
+	}
+}
+
+// LeaseReservation adds the endpoint that promotes an active lease to a reservation.
+// It needs both the lease database and the host directory; when either is missing (nil or empty),
+// the endpoint responds that it is not available and says which one.
+// With both, new reservations with ipv4 auto also avoid the leased addresses.
+func LeaseReservation(r *gin.Engine, db *gorm.DB, hostDirPath string) *gin.Engine {
+	if db != nil && hostDirPath != "" {
+		avoidLeases(hostDirPath, &leaseDatabase{db: db})
+	}
+
+	r.POST("/leases/:mac/reserve", func(c *gin.Context) {
+		if db == nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "reserving a lease requires the lease database (-f database-file)"})
+		} else if hostDirPath == "" {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "reserving a lease requires the host directory (-h host-dir)"})
+		} else {
+			reserveLease(c, db, openHostDirectory(hostDirPath))
+		}
+	})
+
+	return r
+}
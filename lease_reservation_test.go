@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouterForLeaseReservationTests() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	db, _ := OpenLeaseDatabase(":memory:")
+	db.Exec(testDatabaseSQL)
+	os.Mkdir("./test_hosts", 0755)
+	DhcpHostDir(r, "./test_hosts")
+	return LeaseReservation(r, db, "./test_hosts")
+}
+
+func TestReserveLease(t *testing.T) {
+	r := setupRouterForLeaseReservationTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/leases/BC:32:B2:3B:13:D4/reserve", strings.NewReader(`{"tags": ["phone"], "lease_time": "1d"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response struct {
+		Reservation reservation `json:"reservation"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "192.168.1.9", response.Reservation.IPv4)
+	assert.Equal(t, "Adam-s-Phone", response.Reservation.Hostname)
+
+	content, _ := os.ReadFile("./test_hosts/bc:32:b2:3b:13:d4")
+	assert.Equal(t, "bc:32:b2:3b:13:d4,set:phone,192.168.1.9,Adam-s-Phone,1d\n", string(content))
+
+	// Reserving it again conflicts with the reservation
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/leases/bc:32:b2:3b:13:d4/reserve", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestReserveLeaseWithoutHostname(t *testing.T) {
+	r := setupRouterForLeaseReservationTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/leases/84:28:59:86:57:36/reserve", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	content, _ := os.ReadFile("./test_hosts/84:28:59:86:57:36")
+	assert.Equal(t, "84:28:59:86:57:36,192.168.1.208\n", string(content))
+}
+
+func TestReserveLeaseNotFound(t *testing.T) {
+	r := setupRouterForLeaseReservationTests()
+	defer removeTestHostDir()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/leases/00:1a:2b:3c:4d:5e/reserve", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/leases/invalid/reserve", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReserveLeaseRequiresBoth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := OpenLeaseDatabase(":memory:")
+
+	for _, r := range []*gin.Engine{
+		LeaseReservation(gin.Default(), nil, "./test_hosts"),
+		LeaseReservation(gin.Default(), db, ""),
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/leases/bc:32:b2:3b:13:d4/reserve", nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+		assert.Contains(t, w.Body.String(), "requires")
+	}
+}
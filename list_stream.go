@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// listFormat returns the MIME type to write a list in: that of the format parameter
+// or else the one of JSON, NDJSON and CSV the Accept header prefers.
+// An Accept header that allows none of them, e.g., application/xml, gets JSON.
+func listFormat(c *gin.Context) string {
+	accepted := c.NegotiateFormat(gin.MIMEJSON, mimeNDJSON, mimeCSV)
+	if accepted == "" {
+		accepted = gin.MIMEJSON
+	}
+	return reservationFormat(c, accepted)
+}
+
+// listWriter writes the items of a list as NDJSON or CSV as they come rather than all at once.
+type listWriter struct {
+	encoder *json.Encoder
+	csv     *csv.Writer
+}
+
+// newListWriter responds with 200 in the format, writing the header when it is CSV.
+func newListWriter(c *gin.Context, format string, header []string) *listWriter {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", format)
+	if format == mimeCSV {
+		w := &listWriter{csv: csv.NewWriter(c.Writer)}
+		w.csv.Write(header)
+		return w
+	}
+	return &listWriter{encoder: json.NewEncoder(c.Writer)}
+}
+
+// write writes the item as a line of JSON or its record as a line of CSV.
+// An error means the client has gone away.
+func (w *listWriter) write(item any, record []string) error {
+	if w.csv != nil {
+		return w.csv.Write(record)
+	}
+	return w.encoder.Encode(item)
+}
+
+// fail ends the list early so the client can tell it is incomplete: NDJSON with a last line that has the error
+// and, since CSV has no place for one, CSV by closing the connection before the response is complete.
+func (w *listWriter) fail(c *gin.Context, err error) {
+	if w.csv == nil {
+		w.encoder.Encode(gin.H{"error": err.Error()})
+		return
+	}
+	w.csv.Flush()
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		conn.Close()
+	}
+}
+
+// close writes what is still buffered.
+func (w *listWriter) close() {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+}
+
+// writeList responds with the items as JSON, NDJSON or CSV, the header and record naming and giving the CSV columns.
+func writeList[T any](c *gin.Context, items []T, header []string, record func(T) []string) {
+	format := listFormat(c)
+	if format == gin.MIMEJSON {
+		c.JSON(http.StatusOK, items)
+		return
+	}
+	w := newListWriter(c, format, header)
+	defer w.close()
+	for _, item := range items {
+		if w.write(item, record(item)) != nil {
+			return
+		}
+	}
+}
+
+// streamRows responds with each row of the query as NDJSON or CSV as it is read, so memory use stays flat.
+// A row that cannot be read after the response has begun ends it with listWriter.fail.
+// item returns what to write for a row: the value to encode as JSON and the CSV record.
+func streamRows[R any](c *gin.Context, query *gorm.DB, header []string, item func(R) (any, []string)) {
+	rows, err := query.Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	w := newListWriter(c, listFormat(c), header)
+	defer w.close()
+	for rows.Next() {
+		var row R
+		if err := query.ScanRows(rows, &row); err != nil {
+			w.fail(c, err)
+			return
+		}
+		if w.write(item(row)) != nil {
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		w.fail(c, err)
+	}
+}
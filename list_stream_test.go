@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func getList(r *gin.Engine, url, accept string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLeasesNDJSON(t *testing.T) {
+	router := setupRouter()
+
+	w := getList(router, "/leases?sort=mac&limit=3&offset=1", mimeNDJSON)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, mimeNDJSON, w.Header().Get("Content-Type"))
+
+	var macs []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var lease struct {
+			Mac  string `json:"mac"`
+			IPv4 string `json:"ipv4"`
+		}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &lease))
+		macs = append(macs, lease.Mac)
+	}
+	assert.Len(t, macs, 3)
+	assert.True(t, sort.StringsAreSorted(macs))
+
+	var all []struct {
+		Mac string `json:"mac"`
+	}
+	json.Unmarshal(getList(router, "/leases?sort=mac", "").Body.Bytes(), &all)
+	assert.Equal(t, all[1].Mac, macs[0])
+
+	// The headers describe the page as they do for JSON
+	page := getList(router, "/leases?sort=mac&limit=3&offset=1", "")
+	assert.Equal(t, strconv.Itoa(len(all)), w.Header().Get(totalCountHeader))
+	assert.Equal(t, page.Header().Get(totalCountHeader), w.Header().Get(totalCountHeader))
+	assert.NotEmpty(t, w.Header().Get("Link"))
+	assert.Equal(t, page.Header().Get("Link"), w.Header().Get("Link"))
+
+	assert.Equal(t, http.StatusBadRequest, getList(router, "/leases?sort=bogus", mimeNDJSON).Code)
+}
+
+func TestClientsCSV(t *testing.T) {
+	router := setupRouter()
+
+	w := getList(router, "/clients?format=csv", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, mimeCSV, w.Header().Get("Content-Type"))
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, clientCSVHeader, records[0])
+
+	var clients []struct {
+		Mac string `json:"mac"`
+	}
+	json.Unmarshal(getList(router, "/clients", "").Body.Bytes(), &clients)
+	assert.Len(t, records, len(clients)+1)
+	assert.Equal(t, strconv.Itoa(len(clients)), w.Header().Get(totalCountHeader))
+	assert.Empty(t, w.Header().Get("Link"))
+	for i, client := range clients {
+		assert.Equal(t, client.Mac, records[i+1][1]) // the same order as JSON
+	}
+}
+
+func TestRequestsCSV(t *testing.T) {
+	router := setupRouter()
+
+	w := getList(router, "/requests?range=192.168.1.1-15", mimeCSV)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, requestCSVHeader, records[0])
+	assert.Len(t, records, 2)
+	assert.Equal(t, "1", w.Header().Get(totalCountHeader))
+	assert.Equal(t, []string{"192.168.1.9", "bc:32:b2:3b:13:d4", "Adam-s-Phone", "android-dhcp-14"}, records[1][:4])
+}
+
+func TestAddressesCSV(t *testing.T) {
+	router := setupRouter()
+
+	w := getList(router, "/addresses/bc:32:b2:3b:13:d4", mimeCSV)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), strings.Join(addressCSVHeader, ",")+"\n"))
+}
+
+func TestReservationsNDJSON(t *testing.T) {
+	r := setupRouterForReservationsTests()
+	defer removeTestHostDir()
+
+	for _, body := range []string{
+		`{"mac": "00:1a:2b:3c:4d:5e", "ipv4": "192.168.1.100", "hostname": "one", "tags": ["iot"]}`,
+		`{"mac": "00:1a:2b:3c:4d:5f", "ipv4": "192.168.1.101", "hostname": "two", "tags": ["iot"]}`,
+	} {
+		assert.Equal(t, http.StatusCreated, sendTestRequest(r, "POST", "/reservations", "", body).Code)
+	}
+
+	w := getList(r, "/reservations", mimeNDJSON)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, strings.Count(w.Body.String(), "\n"))
+
+	w = getList(r, "/tags/iot?format=csv", "")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, reservationCSVHeader, records[0])
+	assert.Len(t, records, 3)
+
+	w = getList(r, "/tags", mimeCSV)
+	assert.Equal(t, "tag,count,matches\niot,2,0\n", w.Body.String())
+}
+
+func TestListFormatFallsBackToJSON(t *testing.T) {
+	router := setupRouter()
+
+	for _, accept := range []string{"application/xml", "text/plain"} {
+		w := getList(router, "/leases", accept)
+		assert.Equal(t, http.StatusOK, w.Code, accept)
+		assert.Contains(t, w.Header().Get("Content-Type"), gin.MIMEJSON, accept)
+		var leases []testLeaseTimes
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &leases), accept)
+	}
+}
+
+// testUnreadableRow cannot hold the MAC of a lease, so reading a row fails.
+type testUnreadableRow struct {
+	Mac int
+}
+
+func TestStreamRowsFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := OpenLeaseDatabase(":memory:")
+	db.Exec(testDatabaseSQL)
+	r := gin.New()
+	r.GET("/rows", func(c *gin.Context) {
+		streamRows(c, db.Table("leases").Select("mac"), []string{"mac"}, func(row testUnreadableRow) (any, []string) {
+			return row, []string{strconv.Itoa(row.Mac)}
+		})
+	})
+
+	// NDJSON ends with the error
+	w := getList(r, "/rows", mimeNDJSON)
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Contains(t, lines[len(lines)-1], `"error"`)
+
+	// CSV ends with the connection closed before the response is complete
+	server := httptest.NewServer(r)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/rows?format=csv")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	assert.Error(t, err)
+}
@@ -14,7 +14,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/mattn/go-sqlite3"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -31,15 +30,24 @@ var Version string = "development # 2030-12-31 (unknown@unknown)"
 func main() {
 	name := filepath.Base(os.Args[0])
 
-	var databaseFilePath, hostDirPath, listenOn, pidFilePath, unixSocketPath, userFlag, groupFlag string
-	var daemonize, preserveEnv, verbose bool
+	var databaseFilePath, leaseFilePath, hostDirPath, listenOn, pidFilePath, unixSocketPath, userFlag, groupFlag string
+	var peerURL, replicationMode, peerTokenFilePath string
+	var replicationInterval time.Duration
+	var daemonize, gitHostDir, preserveEnv, verbose bool
 	var maxTokens, maxTokenUses int
 	var tokenTimeout time.Duration
 
 	flag.BoolVar(&daemonize, "d", false, "fork and run as a daemon")
 	flag.BoolVar(&preserveEnv, "E", false, "preserve environment when daemonizing")
 	flag.StringVar(&databaseFilePath, "f", "", "the SQLite database file")
+	flag.StringVar(&leaseFilePath, "L", "", "the Dnsmasq lease file, e.g., '/var/lib/misc/dnsmasq.leases', in place of -f")
+	flag.IntVar(&maxRequestRows, "q", defaultMaxRequestRows, "the most rows a /requests query reads as JSON")
 	flag.StringVar(&hostDirPath, "h", "", "the dhcp-host files directory")
+	flag.BoolVar(&gitHostDir, "G", false, "commit each change to the host directory to git")
+	flag.StringVar(&peerURL, "R", "", "the URL of the peer to replicate the host directory with, e.g., 'http://standby:867'")
+	flag.StringVar(&replicationMode, "m", replicationPull, "push the reservations to the peer or pull them from it")
+	flag.StringVar(&peerTokenFilePath, "k", "", "the file with a token issued by the peer")
+	flag.DurationVar(&replicationInterval, "i", 30*time.Second, "the time between replications")
 	flag.StringVar(&listenOn, "l", "", "the IP address and port to listen on, e.g., ':867'")
 	flag.StringVar(&groupFlag, "g", "", "group to run the process as (requires root)")
 	flag.StringVar(&pidFilePath, "P", defaultPidFile, "the PID file")
@@ -57,7 +65,9 @@ Dnsmasq Web is a database-backed JSON/HTTP API for Dnsmasq.
 
 Usage: %s [options] [-d [daemonize options]]
 Options:
-    -f database-file -h host-dir -l address [-v]
+    -f database-file [-q max-request-rows] | -L lease-file
+    -h host-dir [-G] -l address [-v]
+    [-R peer-url [-m push|pull] [-k token-file] [-i interval]]
 Daemonize Options:
     [-E]
     [-u user] [-g group]
@@ -74,6 +84,11 @@ Using the -u and -g flags to drop root privilege after opening the port is recom
 The tokens are kept in memory and are not persisted across restarts.
 Setting -E copies all environment variables to the child process.
 Setting -T 0 disables token checking entirely.
+A /requests query matching more than -q rows is rejected; any CIDR or range size is fine.
+With -L, only /leases and /clients are served, from the lease file, without ages or numbers of requests.
+Reserving leases (POST /leases/:mac/reserve) requires both -f and -h.
+Replicating with a peer (-R) requires -h; the newer of two different reservations wins.
+Reservations with an expires_at time are deleted, or ignored, within a minute of it.
 `,
 		)
 	}
@@ -89,8 +104,28 @@ Setting -T 0 disables token checking entirely.
 		os.Exit(1)
 	}
 
-	if databaseFilePath == "" && hostDirPath == "" {
-		fmt.Fprintf(os.Stderr, "one or both of -f database-file and -h host-dir are required\n")
+	if databaseFilePath == "" && leaseFilePath == "" && hostDirPath == "" {
+		fmt.Fprintf(os.Stderr, "one or both of -f database-file (or -L lease-file) and -h host-dir are required\n")
+		os.Exit(1)
+	}
+
+	if databaseFilePath != "" && leaseFilePath != "" {
+		fmt.Fprintf(os.Stderr, "-f and -L cannot be used together\n")
+		os.Exit(1)
+	}
+
+	if maxRequestRows < 1 {
+		fmt.Fprintf(os.Stderr, "-q must be a positive number\n")
+		os.Exit(1)
+	}
+
+	if peerURL != "" && hostDirPath == "" {
+		fmt.Fprintf(os.Stderr, "-R requires -h host-dir\n")
+		os.Exit(1)
+	}
+
+	if gitHostDir && hostDirPath == "" {
+		fmt.Fprintf(os.Stderr, "-G requires -h host-dir\n")
 		os.Exit(1)
 	}
 
@@ -212,25 +247,49 @@ Setting -T 0 disables token checking entirely.
 			}
 			os.Exit(0)
 		}()
-		r := gin.Default()
+		var gormDb *gorm.DB
 		if databaseFilePath != "" {
-			gormDb, err := gorm.Open(sqlite.Open(databaseFilePath), &gorm.Config{})
+			var err error
+			gormDb, err = OpenLeaseDatabase(databaseFilePath)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "unable to open database '%s': %v\n",
 					databaseFilePath, err)
 				os.Exit(1)
 			}
-			r = LeaseDatabase(r, gormDb)
 		}
 		if hostDirPath != "" {
-			r = DhcpHostDir(r, hostDirPath)
+			if gitHostDir {
+				if err := GitHostDir(hostDirPath); err != nil {
+					fmt.Fprintf(os.Stderr, "unable to use the host directory as a git work tree: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if peerURL != "" {
+				var peerToken []byte
+				if peerTokenFilePath != "" {
+					var err error
+					if peerToken, err = os.ReadFile(peerTokenFilePath); err != nil {
+						fmt.Fprintf(os.Stderr, "unable to read the peer token: %v\n", err)
+						os.Exit(1)
+					}
+				}
+				err := ReplicateHostDir(hostDirPath, peerURL, replicationMode, strings.TrimSpace(string(peerToken)), replicationInterval)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "unable to replicate with '%s': %v\n", peerURL, err)
+					os.Exit(1)
+				}
+			}
+			go ExpireReservations(hostDirPath)
+		}
+		// As a daemon, use the token checker
+		var ttc TokenChecker
+		if os.Getenv(listenerEnvVarName) != "" && maxTokens > 0 {
+			ttc = NewTokenChecker(maxTokens, maxTokenUses, tokenTimeout)
 		}
+		r := newRouter(ttc, gormDb, leaseFilePath, hostDirPath)
 		// Run the server
 		if os.Getenv(listenerEnvVarName) != "" {
-			// As a daemon and use the token checker
-			ttc := NewTokenChecker(maxTokens, maxTokenUses, tokenTimeout)
-			if maxTokens > 0 {
-				r = TokenCheckerHeader(r, ttc, tokenHeader)
+			if ttc != nil {
 				go func() {
 					// Serve the TokenPublisher over a Unix domain socket
 					if err := TokenCheckerPublisher(gin.Default(), ttc, tokenEndpointPath).RunFd(4); err != nil {
@@ -254,3 +313,22 @@ Setting -T 0 disables token checking entirely.
 		os.Exit(1)
 	}
 }
+
+// newRouter returns the engine with the routes of the lease database (or else the lease file) and the host directory.
+// With a token checker, it requires a token before adding any route, since gin fixes the handlers of a route when
+// it is added, so every route checks the token.
+func newRouter(ttc TokenChecker, db *gorm.DB, leaseFilePath, hostDirPath string) *gin.Engine {
+	r := gin.Default()
+	if ttc != nil {
+		r = TokenCheckerHeader(r, ttc, tokenHeader)
+	}
+	if db != nil {
+		r = LeaseDatabase(r, db)
+	} else if leaseFilePath != "" {
+		r = LeaseFile(r, leaseFilePath, hostDirPath)
+	}
+	if hostDirPath != "" {
+		r = DhcpHostDir(r, hostDirPath)
+	}
+	return LeaseReservation(r, db, hostDirPath)
+}
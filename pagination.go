@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// totalCountHeader is the response header with the number of items in a list before it is paginated.
+const totalCountHeader = "X-Total-Count"
+
+// listOrder is how the items of a list can be sorted.
+type listOrder[T any] struct {
+	keys     []string // the values of the sort parameter, the first being the default
+	compare  map[string]func(a, b T) int
+	tiebreak func(a, b T) int // orders the items that compare equal so the order never changes
+}
+
+// listPage is the part of a list selected by the sort, order, limit and offset query parameters.
+type listPage struct {
+	sortBy     string
+	descending bool
+	limit      int // 0 for every item
+	offset     int
+}
+
+// newListPage returns the page in the request parameters or an error when one is invalid.
+func newListPage(c *gin.Context, keys []string) (listPage, error) {
+	p := listPage{sortBy: c.DefaultQuery("sort", keys[0])}
+	if !slices.Contains(keys, p.sortBy) {
+		return p, fmt.Errorf("sort must be one of %s", strings.Join(keys, ", "))
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		p.descending = true
+	default:
+		return p, fmt.Errorf("order must be asc or desc")
+	}
+	var err error
+	if p.limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil || p.limit < 0 {
+		return p, fmt.Errorf("limit must be a number that is not negative")
+	}
+	if p.offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || p.offset < 0 {
+		return p, fmt.Errorf("offset must be a number that is not negative")
+	}
+	return p, nil
+}
+
+// link returns the URL of the request with the offset of another page.
+func (p listPage) link(c *gin.Context, offset int) string {
+	query := c.Request.URL.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(p.limit))
+	return fmt.Sprintf("<%s?%s>", c.Request.URL.Path, query.Encode())
+}
+
+// setHeaders sets the total count header and, when the list is limited, the Link header to the other pages.
+func (p listPage) setHeaders(c *gin.Context, total int) {
+	c.Header(totalCountHeader, strconv.Itoa(total))
+	if p.limit == 0 {
+		return
+	}
+	last := 0
+	if total > 0 {
+		last = (total - 1) / p.limit * p.limit
+	}
+	links := []string{p.link(c, 0) + `; rel="first"`}
+	if p.offset > 0 {
+		links = append(links, p.link(c, max(p.offset-p.limit, 0))+`; rel="prev"`)
+	}
+	if p.offset+p.limit < total {
+		links = append(links, p.link(c, p.offset+p.limit)+`; rel="next"`)
+	}
+	links = append(links, p.link(c, last)+`; rel="last"`)
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+// requestedPage returns the page in the request parameters.
+// It responds with a 400 and returns false when a parameter is invalid.
+func requestedPage(c *gin.Context, keys []string) (listPage, bool) {
+	p, err := newListPage(c, keys)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return p, false
+	}
+	return p, true
+}
+
+// pageQuery orders the query by the column of the sort key, then by the tiebreak column, and selects the page,
+// counting the rows first to set the total count and Link headers as paginate does.
+// It responds with a 500 and returns false when they cannot be counted.
+func (p listPage) pageQuery(c *gin.Context, query *gorm.DB, columns map[string]string, tiebreak string) (*gorm.DB, bool) {
+	var total int64
+	if err := query.Session(&gorm.Session{NewDB: true}).Table("(?) as counted", query).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	p.setHeaders(c, int(total))
+
+	direction := " ASC"
+	if p.descending {
+		direction = " DESC"
+	}
+	query = query.Order(columns[p.sortBy] + direction).Order(tiebreak + direction)
+	if p.limit > 0 {
+		query = query.Limit(p.limit)
+	}
+	return query.Offset(p.offset), true
+}
+
+// paginate sorts the items by the sort and order parameters and returns those selected by limit and offset,
+// setting the total count and Link headers.
+// It responds with a 400 and returns false when a parameter is invalid.
+func paginate[T any](c *gin.Context, items []T, order listOrder[T]) ([]T, bool) {
+	p, ok := requestedPage(c, order.keys)
+	if !ok {
+		return nil, false
+	}
+
+	compare := order.compare[p.sortBy]
+	sort.SliceStable(items, func(i, j int) bool {
+		result := compare(items[i], items[j])
+		if result == 0 {
+			result = order.tiebreak(items[i], items[j])
+		}
+		if p.descending {
+			return result > 0
+		}
+		return result < 0
+	})
+	p.setHeaders(c, len(items))
+
+	if p.offset >= len(items) {
+		return items[:0], true
+	}
+	items = items[p.offset:]
+	if p.limit > 0 && p.limit < len(items) {
+		items = items[:p.limit]
+	}
+	return items, true
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeasesPagination(t *testing.T) {
+	router := setupRouter()
+
+	get := func(url string) (*httptest.ResponseRecorder, []string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+
+		var response []struct {
+			Mac string `json:"mac"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		macs := make([]string, len(response))
+		for i, lease := range response {
+			macs[i] = lease.Mac
+		}
+		return w, macs
+	}
+
+	w, all := get("/leases?sort=mac")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, sort.StringsAreSorted(all))
+	total, _ := strconv.Atoi(w.Header().Get(totalCountHeader))
+	assert.Equal(t, len(all), total)
+	assert.Empty(t, w.Header().Get("Link"))
+
+	w, page := get("/leases?sort=mac&limit=2&offset=2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, all[2:4], page)
+	assert.Equal(t, strconv.Itoa(total), w.Header().Get(totalCountHeader))
+	link := w.Header().Get("Link")
+	assert.Contains(t, link, `</leases?limit=2&offset=0&sort=mac>; rel="first"`)
+	assert.Contains(t, link, `</leases?limit=2&offset=0&sort=mac>; rel="prev"`)
+	assert.Contains(t, link, `</leases?limit=2&offset=4&sort=mac>; rel="next"`)
+	assert.Contains(t, link, `rel="last"`)
+
+	_, descending := get("/leases?sort=mac&order=desc")
+	assert.Len(t, descending, len(all))
+	assert.Equal(t, all[0], descending[len(descending)-1])
+
+	_, past := get("/leases?offset=1000")
+	assert.Empty(t, past)
+
+	for _, query := range []string{"sort=bogus", "order=up", "limit=-1", "offset=x"} {
+		w, _ := get("/leases?" + query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestAddressesStableOrder(t *testing.T) {
+	router := setupRouter()
+
+	var first string
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/addresses/bc:32:b2:3b:13:d4?sort=ipv4", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		if i == 0 {
+			first = w.Body.String()
+		}
+		assert.Equal(t, first, w.Body.String())
+	}
+}
+
+func TestRequestsPagination(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/requests?cidr=192.168.1.0/24&limit=1", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string][]struct {
+		Mac string `json:"mac"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.Contains(t, response, "192.168.1.9") // numerically the lowest address
+	total, _ := strconv.Atoi(w.Header().Get(totalCountHeader))
+	assert.Greater(t, total, 1)
+
+	// The page is still chosen in the requested order
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/requests?cidr=192.168.1.0/24&limit=1&order=desc", nil)
+	router.ServeHTTP(w, req)
+	response = nil
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.NotContains(t, response, "192.168.1.9")
+	assert.Equal(t, strconv.Itoa(total), w.Header().Get(totalCountHeader))
+	assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+}
@@ -1,15 +1,35 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// tokenIdentityKey is the context key of the identity of the token that authorized a request.
+const tokenIdentityKey = "tokenIdentity"
+
+// tokenIdentity returns a name for the token that identifies it without revealing it.
+func tokenIdentity(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// requestIdentity returns the identity of the token that authorized the request or else the client IP address.
+func requestIdentity(c *gin.Context) string {
+	if identity := c.GetString(tokenIdentityKey); identity != "" {
+		return identity
+	}
+	return c.ClientIP()
+}
+
 // TokenCheckerHeader adds a middleware to the gin engine that requires a valid token in the given header.
 func TokenCheckerHeader(r *gin.Engine, ttc TokenChecker, headerName string) *gin.Engine {
 	r.Use(func(c *gin.Context) {
-		if ttc.Check(c.GetHeader(headerName)) {
+		if token := c.GetHeader(headerName); ttc.Check(token) {
+			c.Set(tokenIdentityKey, tokenIdentity(token))
 			c.Next()
 		} else {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized token"})